@@ -0,0 +1,315 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+	// Passkey is an assertion for a challenge from
+	// /api/me/passkeys/reauth/begin. It may be given instead of Password.
+	Passkey *struct {
+		ChallengeID string          `json:"challenge_id"`
+		Credential  json.RawMessage `json:"credential"`
+	} `json:"passkey"`
+	// Transfers maps the ID of an owned, shared log to the ID of the member
+	// who becomes its new owner.
+	Transfers map[string]string `json:"transfers"`
+	// DeleteSharedLogs deletes owned logs that have members and are not
+	// transferred.
+	DeleteSharedLogs bool `json:"delete_shared_logs"`
+}
+
+type sharedLogMember struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type sharedLogSummary struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Members []sharedLogMember `json:"members"`
+}
+
+// handleDeleteAccount permanently deletes the current user. The request must
+// re-confirm the user's identity with their password or a passkey.
+//
+// Owned logs that other users have joined are not deleted silently. Each must
+// either be transferred to one of its members or deleted by setting
+// delete_shared_logs. Otherwise the response is 409 and lists those logs and
+// their members. Entries the user made in a transferred log are attributed to
+// the new owner so the log's history is kept.
+//
+// Deleting the user cascades to their sessions, passkeys, logs, shares, and
+// entries in logs they do not own.
+func handleDeleteAccount(pool *pgxpool.Pool, wan *webauthn.WebAuthn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+
+		var req deleteAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+
+		switch {
+		case req.Password != "":
+			var passwordHash string
+			err := pool.QueryRow(r.Context(),
+				`SELECT password_hash FROM users WHERE id = $1`,
+				user.ID,
+			).Scan(&passwordHash)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+			if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "password is incorrect"})
+				return
+			}
+		case req.Passkey != nil && wan != nil:
+			if err := verifyReauthPasskey(r.Context(), pool, wan, user.ID, req.Passkey.ChallengeID, req.Passkey.Credential); err != nil {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "passkey verification failed"})
+				return
+			}
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "password or passkey confirmation is required"})
+			return
+		}
+
+		tx, err := pool.Begin(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer tx.Rollback(r.Context())
+
+		sharedLogs, err := listSharedOwnedLogs(r.Context(), tx, user.ID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		sharedByID := make(map[string]sharedLogSummary, len(sharedLogs))
+		for _, l := range sharedLogs {
+			sharedByID[l.ID] = l
+		}
+
+		for logID, memberID := range req.Transfers {
+			l, ok := sharedByID[logID]
+			if !ok {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("log %s is not an owned log with members", logID)})
+				return
+			}
+			isMember := false
+			for _, m := range l.Members {
+				if m.ID == memberID {
+					isMember = true
+					break
+				}
+			}
+			if !isMember {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("new owner of log %q must be one of its members", l.Name)})
+				return
+			}
+		}
+
+		if !req.DeleteSharedLogs {
+			unresolved := []sharedLogSummary{}
+			for _, l := range sharedLogs {
+				if _, ok := req.Transfers[l.ID]; !ok {
+					unresolved = append(unresolved, l)
+				}
+			}
+			if len(unresolved) > 0 {
+				writeJSON(w, http.StatusConflict, map[string]any{
+					"error":       "some owned logs are shared with other users; transfer them or set delete_shared_logs",
+					"shared_logs": unresolved,
+				})
+				return
+			}
+		}
+
+		for logID, memberID := range req.Transfers {
+			if err := transferLog(r.Context(), tx, logID, user.ID, memberID); err != nil {
+				var pgErr *pgconn.PgError
+				if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+					writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("new owner of log %q already has a log with that name", sharedByID[logID].Name)})
+					return
+				}
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+		}
+
+		// Deleting the user deletes their remaining entries in other users'
+		// logs, which may fall in periods with a cached goal streak.
+		if _, err := tx.Exec(r.Context(),
+			`SELECT 1 FROM logs WHERE id IN (SELECT log_id FROM log_entries WHERE user_id = $1) ORDER BY id FOR SHARE`,
+			user.ID,
+		); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if _, err := tx.Exec(r.Context(),
+			`DELETE FROM goal_streaks WHERE log_id IN (SELECT log_id FROM log_entries WHERE user_id = $1)`,
+			user.ID,
+		); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		if _, err := tx.Exec(r.Context(), `DELETE FROM users WHERE id = $1`, user.ID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		if err := tx.Commit(r.Context()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		clearSessionCookie(w)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listSharedOwnedLogs returns the logs owned by userID that have at least one
+// member, ordered by name.
+func listSharedOwnedLogs(ctx context.Context, tx pgx.Tx, userID string) ([]sharedLogSummary, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT l.id, l.name, u.id, u.username
+		 FROM logs l
+		 JOIN log_shares ls ON ls.log_id = l.id
+		 JOIN users u ON ls.user_id = u.id
+		 WHERE l.user_id = $1
+		 ORDER BY lower(l.name), l.id, lower(u.username)`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []sharedLogSummary
+	for rows.Next() {
+		var logID, name string
+		var m sharedLogMember
+		if err := rows.Scan(&logID, &name, &m.ID, &m.Username); err != nil {
+			return nil, err
+		}
+		if len(logs) == 0 || logs[len(logs)-1].ID != logID {
+			logs = append(logs, sharedLogSummary{ID: logID, Name: name})
+		}
+		logs[len(logs)-1].Members = append(logs[len(logs)-1].Members, m)
+	}
+	return logs, rows.Err()
+}
+
+// transferLog makes newOwnerID the owner of logID. The new owner's membership
+// is removed since owners are not members, and the share token is revoked.
+// Entries by the previous owner are kept under their username so the log
+// still shows who recorded them once their account is deleted.
+func transferLog(ctx context.Context, tx pgx.Tx, logID, oldOwnerID, newOwnerID string) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE logs SET user_id = $1, share_token = NULL, updated_at = now() WHERE id = $2`,
+		newOwnerID, logID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM log_shares WHERE log_id = $1 AND user_id = $2`,
+		logID, newOwnerID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE log_entries SET user_id = NULL, deleted_username = users.username
+		 FROM users
+		 WHERE log_entries.log_id = $1 AND log_entries.user_id = $2 AND users.id = $2`,
+		logID, oldOwnerID,
+	)
+	return err
+}
+
+// handleReauthPasskeyBegin starts a passkey assertion limited to the current
+// user's credentials. The assertion is used to confirm sensitive actions such
+// as deleting the account.
+func handleReauthPasskeyBegin(pool *pgxpool.Pool, wan *webauthn.WebAuthn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+
+		wanUser, err := loadWebAuthnUser(r.Context(), pool, user.ID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if len(wanUser.WebAuthnCredentials()) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no passkeys registered"})
+			return
+		}
+
+		assertion, session, err := wan.BeginLogin(wanUser)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		challengeID, err := storeChallenge(r.Context(), pool, &user.ID, session, "reauth")
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"options":      assertion,
+			"challenge_id": challengeID,
+		})
+	}
+}
+
+// verifyReauthPasskey checks a passkey assertion for a challenge created by
+// handleReauthPasskeyBegin for userID.
+func verifyReauthPasskey(ctx context.Context, pool *pgxpool.Pool, wan *webauthn.WebAuthn, userID, challengeID string, rawCredential json.RawMessage) error {
+	session, err := loadAndDeleteChallenge(ctx, pool, challengeID, "reauth")
+	if err != nil {
+		return err
+	}
+
+	parsedResponse, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(rawCredential))
+	if err != nil {
+		return err
+	}
+
+	wanUser, err := loadWebAuthnUser(ctx, pool, userID)
+	if err != nil {
+		return err
+	}
+
+	credential, err := wan.ValidateLogin(wanUser, *session, parsedResponse)
+	if err != nil {
+		return err
+	}
+
+	pool.Exec(ctx,
+		`UPDATE passkeys SET sign_count = $1, backup_state = $2 WHERE credential_id = $3`,
+		credential.Authenticator.SignCount, credential.Flags.BackupState, credential.ID,
+	)
+	return nil
+}
@@ -0,0 +1,213 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deleteAccount(t *testing.T, srvURL string, body any, cookies []*http.Cookie) (*http.Response, map[string]any) {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest("DELETE", srvURL+"/api/me", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var result map[string]any
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp, result
+}
+
+// createSharedLog creates a log owned by ownerCookies and joins it with each
+// of memberCookies. It returns the log ID.
+func createSharedLog(t *testing.T, srvURL, name string, ownerCookies []*http.Cookie, memberCookies ...[]*http.Cookie) string {
+	t.Helper()
+	resp, created := postJSON(srvURL+"/api/logs", map[string]any{"name": name}, ownerCookies)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	logID := created["id"].(string)
+
+	_, tokenBody := postJSON(srvURL+"/api/logs/"+logID+"/share-token", map[string]any{}, ownerCookies)
+	for _, c := range memberCookies {
+		resp, _ := postJSON(srvURL+"/api/join/"+tokenBody["share_token"].(string), map[string]any{}, c)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	return logID
+}
+
+func TestDeleteAccount_Success(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+	postJSON(srv.URL+"/api/logs", map[string]any{"name": "Pushups"}, cookies)
+
+	resp, _ := deleteAccount(t, srv.URL, map[string]any{"password": "password123"}, cookies)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// The session is revoked with the account.
+	resp, _ = getJSON(srv.URL+"/api/me", cookies)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, _ = postJSON(srv.URL+"/api/login", map[string]any{
+		"username": "alice",
+		"password": "password123",
+	}, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// The username is available again.
+	registerUser(t, srv.URL, "alice")
+}
+
+func TestDeleteAccount_RequiresConfirmation(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	resp, body := deleteAccount(t, srv.URL, map[string]any{}, cookies)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "password or passkey confirmation is required", body["error"])
+
+	resp, body = deleteAccount(t, srv.URL, map[string]any{"password": "wrongpassword"}, cookies)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "password is incorrect", body["error"])
+
+	resp, _ = getJSON(srv.URL+"/api/me", cookies)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDeleteAccount_Unauthenticated(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	resp, _ := deleteAccount(t, srv.URL, map[string]any{"password": "password123"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestDeleteAccount_ListsSharedLogs(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	aliceCookies := registerUser(t, srv.URL, "alice")
+	bobCookies := registerUser(t, srv.URL, "bob")
+	logID := createSharedLog(t, srv.URL, "Family", aliceCookies, bobCookies)
+	postJSON(srv.URL+"/api/logs", map[string]any{"name": "Private"}, aliceCookies)
+
+	resp, body := deleteAccount(t, srv.URL, map[string]any{"password": "password123"}, aliceCookies)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	sharedLogs := body["shared_logs"].([]any)
+	require.Len(t, sharedLogs, 1)
+	shared := sharedLogs[0].(map[string]any)
+	assert.Equal(t, logID, shared["id"])
+	assert.Equal(t, "Family", shared["name"])
+	members := shared["members"].([]any)
+	require.Len(t, members, 1)
+	assert.Equal(t, "bob", members[0].(map[string]any)["username"])
+
+	// Nothing was deleted.
+	resp, _ = getJSON(srv.URL+"/api/me", aliceCookies)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDeleteAccount_DeleteSharedLogs(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	aliceCookies := registerUser(t, srv.URL, "alice")
+	bobCookies := registerUser(t, srv.URL, "bob")
+	logID := createSharedLog(t, srv.URL, "Family", aliceCookies, bobCookies)
+
+	resp, _ := deleteAccount(t, srv.URL, map[string]any{
+		"password":           "password123",
+		"delete_shared_logs": true,
+	}, aliceCookies)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = getJSON(srv.URL+"/api/logs/"+logID, bobCookies)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDeleteAccount_TransferSharedLog(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	aliceCookies := registerUser(t, srv.URL, "alice")
+	bobCookies := registerUser(t, srv.URL, "bob")
+	carolCookies := registerUser(t, srv.URL, "carol")
+	logID := createSharedLog(t, srv.URL, "Family", aliceCookies, bobCookies, carolCookies)
+
+	resp, _ := postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{}, aliceCookies)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	_, bob := getJSON(srv.URL+"/api/me", bobCookies)
+
+	resp, _ = deleteAccount(t, srv.URL, map[string]any{
+		"password":  "password123",
+		"transfers": map[string]string{logID: bob["id"].(string)},
+	}, aliceCookies)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, log := getJSON(srv.URL+"/api/logs/"+logID, bobCookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, true, log["is_owner"])
+
+	// Alice's entry is kept and still shows that she recorded it.
+	resp, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", bobCookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "alice", entries[0]["username"])
+	assert.Nil(t, entries[0]["user_id"])
+
+	resp, entries, _ = getEntryPage(srv.URL+"/api/logs/"+logID+"/entries?username=alice", bobCookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, entries, 1)
+
+	// The entry can still be edited by the new owner.
+	resp, edited := putJSON(srv.URL+"/api/logs/"+logID+"/entries/"+entries[0]["id"].(string), map[string]any{
+		"occurred_at": "2025-06-15T10:30:00Z",
+	}, bobCookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "alice", edited["username"])
+
+	// Other members keep their access.
+	resp, _ = getJSON(srv.URL+"/api/logs/"+logID, carolCookies)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDeleteAccount_TransferToNonMember(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	aliceCookies := registerUser(t, srv.URL, "alice")
+	bobCookies := registerUser(t, srv.URL, "bob")
+	carolCookies := registerUser(t, srv.URL, "carol")
+	logID := createSharedLog(t, srv.URL, "Family", aliceCookies, bobCookies)
+
+	_, carol := getJSON(srv.URL+"/api/me", carolCookies)
+
+	resp, _ := deleteAccount(t, srv.URL, map[string]any{
+		"password":  "password123",
+		"transfers": map[string]string{logID: carol["id"].(string)},
+	}, aliceCookies)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestReauthPasskeyBegin_NoPasskeys(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	resp, body := postJSON(srv.URL+"/api/me/passkeys/reauth/begin", map[string]any{}, cookies)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "no passkeys registered", body["error"])
+}
@@ -0,0 +1,513 @@
+package backend
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// accountArchiveVersion is incremented whenever the archive format changes in
+// a way older readers cannot handle. Archives from minAccountArchiveVersion on
+// can still be restored.
+const (
+	accountArchiveVersion    = 2
+	minAccountArchiveVersion = 1
+)
+
+const maxArchiveBytes = 100 << 20
+
+// accountArchive is a portable copy of everything a user owns. Entries and
+// shares refer to other users by username so an archive can be restored on a
+// different instance.
+type accountArchive struct {
+	Version    int                     `json:"version"`
+	ExportedAt time.Time               `json:"exported_at"`
+	User       archiveUser             `json:"user"`
+	Logs       []archiveLog            `json:"logs"`
+	Passkeys   []archivePasskeyDetails `json:"passkeys"`
+}
+
+type archiveUser struct {
+	Username  string    `json:"username"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type archiveLog struct {
+	Name                    string            `json:"name"`
+	Fields                  []fieldDefinition `json:"fields"`
+	Goal                    *logGoal          `json:"goal,omitempty"`
+	ExpectedIntervalSeconds *int              `json:"expected_interval_seconds,omitempty"`
+	CreatedAt               time.Time         `json:"created_at"`
+	UpdatedAt               time.Time         `json:"updated_at"`
+	Entries                 []archiveEntry    `json:"entries"`
+	Shares                  []archiveShare    `json:"shares"`
+	// Reminders are the account's own reminder rules for the log.
+	Reminders []archiveReminder `json:"reminders,omitempty"`
+}
+
+type archiveEntry struct {
+	Username string         `json:"username"`
+	Fields   map[string]any `json:"fields"`
+	// UnconvertedFields holds values kept from failed type conversions, keyed
+	// by field ID.
+	UnconvertedFields map[string]any `json:"unconverted_fields,omitempty"`
+	OccurredAt        time.Time      `json:"occurred_at"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+type archiveShare struct {
+	Username string    `json:"username"`
+	SharedAt time.Time `json:"shared_at"`
+}
+
+// archiveReminder is a reminder rule. A restored rule counts as created when
+// it is restored, so reminders missed before then are not sent.
+type archiveReminder struct {
+	Schedule              *string `json:"schedule,omitempty"`
+	SinceLastEntrySeconds *int    `json:"since_last_entry_seconds,omitempty"`
+	TZ                    string  `json:"tz"`
+	QuietStart            *string `json:"quiet_start,omitempty"`
+	QuietEnd              *string `json:"quiet_end,omitempty"`
+}
+
+// archivePasskeyDetails records which passkeys an account had. Credentials are
+// bound to the server's relying party, so passkeys are informational only and
+// are not restored.
+type archivePasskeyDetails struct {
+	Description    string    `json:"description"`
+	AAGUID         string    `json:"aaguid"`
+	BackupEligible bool      `json:"backup_eligible"`
+	BackupState    bool      `json:"backup_state"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type importAccountResult struct {
+	Logs          int      `json:"logs"`
+	Entries       int      `json:"entries"`
+	Shares        int      `json:"shares"`
+	SkippedShares []string `json:"skipped_shares"`
+	Reminders     int      `json:"reminders"`
+}
+
+var errAccountNotEmpty = errors.New("account already has logs")
+var errInvalidArchive = errors.New("invalid archive")
+
+// exportAccount builds an archive of the logs, entries, shares and passkeys
+// owned by userID, and of userID's reminder rules for those logs.
+func exportAccount(ctx context.Context, pool *pgxpool.Pool, userID string) (*accountArchive, error) {
+	archive := &accountArchive{
+		Version:    accountArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		Logs:       []archiveLog{},
+		Passkeys:   []archivePasskeyDetails{},
+	}
+
+	// Read everything from one snapshot so the archive is consistent even if
+	// the account is being used while it is exported.
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`SELECT username, email, created_at FROM users WHERE id = $1`,
+		userID,
+	).Scan(&archive.User.Username, &archive.User.Email, &archive.User.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT id, name, fields, goal, expected_interval_seconds, created_at, updated_at FROM logs WHERE user_id = $1 ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var logIDs []string
+	for rows.Next() {
+		var id string
+		l := archiveLog{Entries: []archiveEntry{}, Shares: []archiveShare{}}
+		if err := rows.Scan(&id, &l.Name, &l.Fields, &l.Goal, &l.ExpectedIntervalSeconds, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if l.Fields == nil {
+			l.Fields = []fieldDefinition{}
+		}
+		logIDs = append(logIDs, id)
+		archive.Logs = append(archive.Logs, l)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	for i, logID := range logIDs {
+		l := &archive.Logs[i]
+
+		rows, err := tx.Query(ctx,
+			`SELECT coalesce(u.username, le.deleted_username), le.fields, le.unconverted_fields, le.occurred_at, le.created_at, le.updated_at
+			 FROM log_entries le
+			 LEFT JOIN users u ON le.user_id = u.id
+			 WHERE le.log_id = $1
+			 ORDER BY le.occurred_at, le.id`,
+			logID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var e archiveEntry
+			if err := rows.Scan(&e.Username, &e.Fields, &e.UnconvertedFields, &e.OccurredAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if e.Fields == nil {
+				e.Fields = map[string]any{}
+			}
+			l.Entries = append(l.Entries, e)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		rows, err = tx.Query(ctx,
+			`SELECT u.username, ls.created_at
+			 FROM log_shares ls
+			 JOIN users u ON ls.user_id = u.id
+			 WHERE ls.log_id = $1
+			 ORDER BY ls.created_at`,
+			logID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var s archiveShare
+			if err := rows.Scan(&s.Username, &s.SharedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			l.Shares = append(l.Shares, s)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		rows, err = tx.Query(ctx,
+			`SELECT schedule, since_last_entry_seconds, tz, quiet_start, quiet_end
+			 FROM reminder_rules
+			 WHERE log_id = $1 AND user_id = $2
+			 ORDER BY created_at, id`,
+			logID, userID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var rem archiveReminder
+			if err := rows.Scan(&rem.Schedule, &rem.SinceLastEntrySeconds, &rem.TZ, &rem.QuietStart, &rem.QuietEnd); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			l.Reminders = append(l.Reminders, rem)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+	}
+
+	rows, err = tx.Query(ctx,
+		`SELECT description, aaguid, backup_eligible, backup_state, created_at FROM passkeys WHERE user_id = $1 ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p archivePasskeyDetails
+		var aaguid []byte
+		if err := rows.Scan(&p.Description, &aaguid, &p.BackupEligible, &p.BackupState, &p.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.AAGUID = hex.EncodeToString(aaguid)
+		archive.Passkeys = append(archive.Passkeys, p)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// validateArchive checks that archive can be restored by this version of
+// Logger4Life.
+func validateArchive(archive *accountArchive) error {
+	if archive.Version < minAccountArchiveVersion || archive.Version > accountArchiveVersion {
+		return fmt.Errorf("%w: unsupported version %d (expected %d to %d)", errInvalidArchive, archive.Version, minAccountArchiveVersion, accountArchiveVersion)
+	}
+	for i := range archive.Logs {
+		l := &archive.Logs[i]
+		l.Name = strings.TrimSpace(l.Name)
+		if len(l.Name) == 0 || len(l.Name) > 100 {
+			return fmt.Errorf("%w: log %d: name must be 1-100 characters", errInvalidArchive, i+1)
+		}
+		if l.Fields == nil {
+			l.Fields = []fieldDefinition{}
+		}
+		if err := validateFieldDefinitions(l.Fields); err != nil {
+			return fmt.Errorf("%w: log %q: %v", errInvalidArchive, l.Name, err)
+		}
+		if l.Goal != nil {
+			if err := validateGoal(l.Goal, l.Fields); err != nil {
+				return fmt.Errorf("%w: log %q: goal: %v", errInvalidArchive, l.Name, err)
+			}
+		}
+		if err := validateExpectedInterval(l.ExpectedIntervalSeconds); err != nil {
+			return fmt.Errorf("%w: log %q: %v", errInvalidArchive, l.Name, err)
+		}
+		if err := validateArchiveEntries(l); err != nil {
+			return fmt.Errorf("%w: log %q: %v", errInvalidArchive, l.Name, err)
+		}
+		for j := range l.Reminders {
+			rem := &l.Reminders[j]
+			rule := reminderRule{
+				Schedule:              rem.Schedule,
+				SinceLastEntrySeconds: rem.SinceLastEntrySeconds,
+				TZ:                    rem.TZ,
+				QuietStart:            rem.QuietStart,
+				QuietEnd:              rem.QuietEnd,
+			}
+			if err := validateReminderRule(&rule); err != nil {
+				return fmt.Errorf("%w: log %q: reminder %d: %v", errInvalidArchive, l.Name, j+1, err)
+			}
+			rem.Schedule, rem.TZ, rem.QuietStart, rem.QuietEnd = rule.Schedule, rule.TZ, rule.QuietStart, rule.QuietEnd
+		}
+	}
+	return nil
+}
+
+// validateArchiveEntries checks the field values of the entries in l and
+// rewrites them to the form they are stored in. Entries may predate the
+// log's current field settings, so required fields, archived fields, retired
+// options and number constraints are not enforced.
+func validateArchiveEntries(l *archiveLog) error {
+	definitions := make([]fieldDefinition, len(l.Fields))
+	fieldIDs := make(map[string]bool, len(l.Fields))
+	for i, f := range l.Fields {
+		fieldIDs[f.ID] = true
+		f.Required = false
+		f.Archived = false
+		f.Min, f.Max, f.Step, f.Integer = nil, nil, nil, false
+		definitions[i] = f
+	}
+
+	for i := range l.Entries {
+		e := &l.Entries[i]
+		if e.Fields == nil {
+			e.Fields = map[string]any{}
+		}
+		if err := validateUpdatedFieldValues(definitions, e.Fields, maps.Clone(e.Fields)); err != nil {
+			return fmt.Errorf("entry %d: %v", i+1, err)
+		}
+		if e.UnconvertedFields == nil {
+			e.UnconvertedFields = map[string]any{}
+		}
+		for fieldID := range e.UnconvertedFields {
+			if !fieldIDs[fieldID] {
+				return fmt.Errorf("entry %d: unconverted value for unknown field id: %s", i+1, fieldID)
+			}
+		}
+	}
+	return nil
+}
+
+// importAccount restores archive into the account userID in a single
+// transaction. The account must not own any logs.
+//
+// With matchUsers set, entries and shares are restored for the users on this
+// instance with the usernames in the archive. Entries by users that do not
+// exist are attributed to userID, and shares with such users are skipped. The
+// archive is not signed, so only an administrator may trust it this way.
+// Otherwise every entry is attributed to userID and every share is skipped.
+func importAccount(ctx context.Context, pool *pgxpool.Pool, userID string, archive *accountArchive, matchUsers bool) (*importAccountResult, error) {
+	if err := validateArchive(archive); err != nil {
+		return nil, err
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var hasLogs bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM logs WHERE user_id = $1)`, userID).Scan(&hasLogs)
+	if err != nil {
+		return nil, err
+	}
+	if hasLogs {
+		return nil, errAccountNotEmpty
+	}
+
+	userIDs := make(map[string]string)
+	if matchUsers {
+		seen := make(map[string]bool)
+		var usernames []string
+		addUsername := func(username string) {
+			username = strings.ToLower(username)
+			if !seen[username] {
+				seen[username] = true
+				usernames = append(usernames, username)
+			}
+		}
+		for _, l := range archive.Logs {
+			for _, e := range l.Entries {
+				addUsername(e.Username)
+			}
+			for _, s := range l.Shares {
+				addUsername(s.Username)
+			}
+		}
+
+		rows, err := tx.Query(ctx, `SELECT id, lower(username) FROM users WHERE lower(username) = ANY($1)`, usernames)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id, username string
+			if err := rows.Scan(&id, &username); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			userIDs[username] = id
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+	}
+
+	result := &importAccountResult{SkippedShares: []string{}}
+	for _, l := range archive.Logs {
+		var logID string
+		err := tx.QueryRow(ctx,
+			`INSERT INTO logs (user_id, name, fields, goal, expected_interval_seconds, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+			userID, l.Name, l.Fields, l.Goal, l.ExpectedIntervalSeconds, l.CreatedAt, l.UpdatedAt,
+		).Scan(&logID)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return nil, fmt.Errorf("%w: duplicate log name: %s", errInvalidArchive, l.Name)
+			}
+			return nil, err
+		}
+		result.Logs++
+
+		batch := &pgx.Batch{}
+		for _, e := range l.Entries {
+			entryUserID, ok := userIDs[strings.ToLower(e.Username)]
+			if !ok {
+				entryUserID = userID
+			}
+			batch.Queue(
+				`INSERT INTO log_entries (log_id, user_id, fields, unconverted_fields, occurred_at, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				logID, entryUserID, e.Fields, e.UnconvertedFields, e.OccurredAt, e.CreatedAt, e.UpdatedAt,
+			)
+		}
+		for _, s := range l.Shares {
+			shareUserID, ok := userIDs[strings.ToLower(s.Username)]
+			if !ok || shareUserID == userID {
+				result.SkippedShares = append(result.SkippedShares, s.Username)
+				continue
+			}
+			batch.Queue(
+				`INSERT INTO log_shares (log_id, user_id, created_at) VALUES ($1, $2, $3)`,
+				logID, shareUserID, s.SharedAt,
+			)
+			result.Shares++
+		}
+		for _, rem := range l.Reminders {
+			batch.Queue(
+				`INSERT INTO reminder_rules (log_id, user_id, schedule, since_last_entry_seconds, tz, quiet_start, quiet_end)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				logID, userID, rem.Schedule, rem.SinceLastEntrySeconds, rem.TZ, rem.QuietStart, rem.QuietEnd,
+			)
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return nil, err
+		}
+		result.Entries += len(l.Entries)
+		result.Reminders += len(l.Reminders)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func handleExportAccount(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+
+		archive, err := exportAccount(r.Context(), pool, user.ID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "logger4life-"+user.Username+".json"))
+		writeJSON(w, http.StatusOK, archive)
+	}
+}
+
+func handleImportAccount(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+
+		var archive accountArchive
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxArchiveBytes)).Decode(&archive); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+
+		result, err := importAccount(r.Context(), pool, user.ID, &archive, false)
+		if err != nil {
+			if errors.Is(err, errAccountNotEmpty) {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": "account must not have any logs before importing"})
+				return
+			}
+			if errors.Is(err, errInvalidArchive) {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, result)
+	}
+}
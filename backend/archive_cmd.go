@@ -0,0 +1,136 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+)
+
+var exportUserCmd = &cobra.Command{
+	Use:   "export-user",
+	Short: "Export a user's logs and entries to a JSON archive",
+	RunE:  runExportUser,
+}
+
+var importUserCmd = &cobra.Command{
+	Use:   "import-user",
+	Short: "Restore a JSON archive into an existing account that has no logs",
+	RunE:  runImportUser,
+}
+
+var archiveUsername string
+var archivePath string
+
+func init() {
+	rootCmd.AddCommand(exportUserCmd)
+	exportUserCmd.Flags().StringVar(&configFile, "config", "", "path to configuration file")
+	exportUserCmd.Flags().StringVar(&archiveUsername, "username", "", "username of the account to export")
+	exportUserCmd.Flags().StringVar(&archivePath, "output", "", "path to write the archive (default stdout)")
+	exportUserCmd.MarkFlagRequired("username")
+
+	rootCmd.AddCommand(importUserCmd)
+	importUserCmd.Flags().StringVar(&configFile, "config", "", "path to configuration file")
+	importUserCmd.Flags().StringVar(&archiveUsername, "username", "", "username of the account to restore into")
+	importUserCmd.Flags().StringVar(&archivePath, "input", "", "path to read the archive from (default stdin)")
+	importUserCmd.MarkFlagRequired("username")
+}
+
+func runExportUser(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	pool, userID, err := connectForArchive(ctx, archiveUsername)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	archive, err := exportAccount(ctx, pool, userID)
+	if err != nil {
+		return fmt.Errorf("unable to export account: %w", err)
+	}
+
+	if archivePath == "" {
+		return writeArchive(cmd.OutOrStdout(), archive)
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("unable to create output file: %w", err)
+	}
+	if err := writeArchive(f, archive); err != nil {
+		f.Close()
+		return err
+	}
+	// A failed close can mean the archive never reached the disk.
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write output file: %w", err)
+	}
+	return nil
+}
+
+func writeArchive(w io.Writer, archive *accountArchive) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(archive)
+}
+
+func runImportUser(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	var in io.Reader = cmd.InOrStdin()
+	if archivePath != "" {
+		f, err := os.Open(archivePath)
+		if err != nil {
+			return fmt.Errorf("unable to open input file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var archive accountArchive
+	if err := json.NewDecoder(in).Decode(&archive); err != nil {
+		return fmt.Errorf("unable to read archive: %w", err)
+	}
+
+	pool, userID, err := connectForArchive(ctx, archiveUsername)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	result, err := importAccount(ctx, pool, userID, &archive, true)
+	if err != nil {
+		return fmt.Errorf("unable to import account: %w", err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Imported %d logs, %d entries, %d shares and %d reminders\n", result.Logs, result.Entries, result.Shares, result.Reminders)
+	for _, username := range result.SkippedShares {
+		fmt.Fprintf(cmd.OutOrStdout(), "Skipped share with unknown user %s\n", username)
+	}
+	return nil
+}
+
+func connectForArchive(ctx context.Context, username string) (*pgxpool.Pool, string, error) {
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pool, err := connectDatabase(ctx, cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var userID string
+	err = pool.QueryRow(ctx, `SELECT id FROM users WHERE lower(username) = lower($1)`, username).Scan(&userID)
+	if err != nil {
+		pool.Close()
+		return nil, "", fmt.Errorf("unable to find user %s: %w", username, err)
+	}
+	return pool, userID, nil
+}
@@ -26,6 +26,7 @@ func setupTestRouterWithConfig(t *testing.T, allowRegistration bool) *httptest.S
 	require.NoError(t, err)
 
 	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DELETE FROM idempotency_keys")
 		pool.Exec(context.Background(), "DELETE FROM webauthn_challenges")
 		pool.Exec(context.Background(), "DELETE FROM passkeys")
 		pool.Exec(context.Background(), "DELETE FROM log_shares")
@@ -56,20 +57,34 @@ func setupTestRouterWithConfig(t *testing.T, allowRegistration bool) *httptest.S
 		r.Get("/api/me", handleMe)
 		r.Put("/api/me/email", handleChangeEmail(pool))
 		r.Put("/api/me/password", handleChangePassword(pool))
+		r.Delete("/api/me", handleDeleteAccount(pool, wan))
+		r.Get("/api/me/export", handleExportAccount(pool))
+		r.Post("/api/me/import", handleImportAccount(pool))
 		r.Get("/api/me/passkeys", handleListPasskeys(pool))
 		r.Put("/api/me/passkeys/{passkeyID}", handleUpdatePasskey(pool))
 		r.Delete("/api/me/passkeys/{passkeyID}", handleDeletePasskey(pool))
 		r.Post("/api/me/passkeys/register/begin", handlePasskeyRegisterBegin(pool, wan))
 		r.Post("/api/me/passkeys/register/finish", handlePasskeyRegisterFinish(pool, wan))
+		r.Post("/api/me/passkeys/reauth/begin", handleReauthPasskeyBegin(pool, wan))
 		r.Post("/api/logs", handleCreateLog(pool))
 		r.Get("/api/logs", handleListLogs(pool))
 		r.Get("/api/logs/{logID}", handleGetLog(pool))
 		r.Put("/api/logs/{logID}", handleUpdateLog(pool))
 		r.Delete("/api/logs/{logID}", handleDeleteLog(pool))
+		r.Put("/api/logs/{logID}/goal", handleSetLogGoal(pool))
+		r.Delete("/api/logs/{logID}/goal", handleDeleteLogGoal(pool))
 		r.Post("/api/logs/{logID}/entries", handleCreateLogEntry(pool))
 		r.Get("/api/logs/{logID}/entries", handleListLogEntries(pool))
+		r.Get("/api/logs/{logID}/entries.csv", handleExportLogEntriesCSV(pool))
+		r.Get("/api/logs/{logID}/stats", handleGetLogStats(pool))
+		r.Get("/api/logs/{logID}/buckets", handleListEntryBuckets(pool))
+		r.Post("/api/logs/{logID}/import", handleImportLogEntriesCSV(pool))
 		r.Put("/api/logs/{logID}/entries/{entryID}", handleUpdateLogEntry(pool))
 		r.Delete("/api/logs/{logID}/entries/{entryID}", handleDeleteLogEntry(pool))
+		r.Post("/api/entries/batch", handleBatchCreateLogEntries(pool))
+		r.Get("/api/logs/{logID}/reminders", handleListReminderRules(pool))
+		r.Post("/api/logs/{logID}/reminders", handleCreateReminderRule(pool))
+		r.Delete("/api/logs/{logID}/reminders/{reminderID}", handleDeleteReminderRule(pool))
 		r.Post("/api/logs/{logID}/share-token", handleCreateShareToken(pool))
 		r.Delete("/api/logs/{logID}/share-token", handleDeleteShareToken(pool))
 		r.Get("/api/logs/{logID}/shares", handleListShares(pool))
@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxBatchEntries = 1000
+
+type batchEntryItem struct {
+	LogID      string         `json:"log_id"`
+	Fields     map[string]any `json:"fields"`
+	OccurredAt *time.Time     `json:"occurred_at"`
+}
+
+type batchCreateEntriesRequest struct {
+	Entries []batchEntryItem `json:"entries"`
+}
+
+type batchItemError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type batchCreateEntriesResponse struct {
+	Entries []logEntryResponse `json:"entries"`
+}
+
+// handleBatchCreateLogEntries inserts many entries, possibly across several
+// logs, in a single transaction. Every item is validated before anything is
+// written. If any item is invalid nothing is inserted and the response lists
+// the error for each failing item by its index in the request.
+func handleBatchCreateLogEntries(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+
+		var req batchCreateEntriesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		if len(req.Entries) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "entries must not be empty"})
+			return
+		}
+		if len(req.Entries) > maxBatchEntries {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("too many entries (max %d)", maxBatchEntries)})
+			return
+		}
+
+		accessByLog := make(map[string]*logAccess)
+		defaultsByLog := make(map[string]map[string]any)
+		var itemErrors []batchItemError
+		for i := range req.Entries {
+			item := &req.Entries[i]
+			if item.Fields == nil {
+				item.Fields = map[string]any{}
+			}
+
+			if item.LogID == "" {
+				itemErrors = append(itemErrors, batchItemError{Index: i, Error: "log_id is required"})
+				continue
+			}
+
+			// An ID that is not a UUID can't name a log, and Postgres would
+			// reject it as input for the whole request.
+			if _, err := uuid.FromString(item.LogID); err != nil {
+				itemErrors = append(itemErrors, batchItemError{Index: i, Error: "log not found"})
+				continue
+			}
+
+			access, ok := accessByLog[item.LogID]
+			if !ok {
+				var err error
+				access, err = checkLogAccess(r.Context(), pool, item.LogID, user.ID)
+				if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+					writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+					return
+				}
+				accessByLog[item.LogID] = access
+				if access != nil {
+					defaultsByLog[item.LogID], err = resolveFieldDefaults(r.Context(), pool, item.LogID, user.ID, access.Fields)
+					if err != nil {
+						writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+						return
+					}
+				}
+			}
+			if access == nil {
+				itemErrors = append(itemErrors, batchItemError{Index: i, Error: "log not found"})
+				continue
+			}
+
+			if item.OccurredAt != nil {
+				if err := validateOccurredAt(*item.OccurredAt); err != nil {
+					itemErrors = append(itemErrors, batchItemError{Index: i, Error: err.Error()})
+					continue
+				}
+			}
+
+			applyFieldDefaults(item.Fields, defaultsByLog[item.LogID])
+			if err := validateFieldValues(access.Fields, item.Fields); err != nil {
+				itemErrors = append(itemErrors, batchItemError{Index: i, Error: err.Error()})
+			}
+		}
+
+		if len(itemErrors) > 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error":  "one or more entries are invalid",
+				"errors": itemErrors,
+			})
+			return
+		}
+
+		tx, err := pool.Begin(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer tx.Rollback(r.Context())
+
+		logIDs := slices.Sorted(maps.Keys(accessByLog))
+		for _, logID := range logIDs {
+			if err := lockLogFields(r.Context(), tx, logID, accessByLog[logID].Fields); err != nil {
+				switch {
+				case errors.Is(err, errLogFieldsChanged):
+					writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				case errors.Is(err, pgx.ErrNoRows):
+					writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+				default:
+					writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				}
+				return
+			}
+		}
+
+		entries, err := insertLogEntries(r.Context(), tx, user, req.Entries)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		for i := range entries {
+			entries[i].FormattedFields = formatEntryFields(accessByLog[entries[i].LogID].Fields, entries[i].Fields)
+		}
+
+		if err := tx.Commit(r.Context()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, batchCreateEntriesResponse{Entries: entries})
+	}
+}
+
+// insertLogEntries inserts already validated items on behalf of user within
+// tx, which must hold a share lock on each of their logs' rows.
+func insertLogEntries(ctx context.Context, tx pgx.Tx, user *AuthUser, items []batchEntryItem) ([]logEntryResponse, error) {
+	entries := make([]logEntryResponse, len(items))
+	batch := &pgx.Batch{}
+	for i, item := range items {
+		batch.Queue(
+			`INSERT INTO log_entries (log_id, user_id, fields, occurred_at) VALUES ($1, $2, $3, coalesce($4, now()))
+			 RETURNING id, log_id, user_id, fields, occurred_at, created_at, updated_at`,
+			item.LogID, user.ID, item.Fields, item.OccurredAt,
+		).QueryRow(func(row pgx.Row) error {
+			e := &entries[i]
+			return row.Scan(&e.ID, &e.LogID, &e.UserID, &e.Fields, &e.OccurredAt, &e.CreatedAt, &e.UpdatedAt)
+		})
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, err
+	}
+
+	earliest := make(map[string]time.Time)
+	for i := range entries {
+		entries[i].Username = user.Username
+		if entries[i].Fields == nil {
+			entries[i].Fields = map[string]any{}
+		}
+		if t, ok := earliest[entries[i].LogID]; !ok || entries[i].OccurredAt.Before(t) {
+			earliest[entries[i].LogID] = entries[i].OccurredAt
+		}
+	}
+	for logID, occurredAt := range earliest {
+		if err := clearGoalStreak(ctx, tx, logID, occurredAt); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
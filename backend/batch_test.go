@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchCreateLogEntries_Success(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, vitamins := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Vitamins"}, cookies)
+	vitaminsID := vitamins["id"].(string)
+	_, pushups := postJSON(srv.URL+"/api/logs", map[string]any{
+		"name": "Pushups",
+		"fields": []map[string]any{
+			{"name": "count", "type": "number", "required": true},
+		},
+	}, cookies)
+	pushupsID := pushups["id"].(string)
+
+	resp, body := postJSON(srv.URL+"/api/entries/batch", map[string]any{
+		"entries": []map[string]any{
+			{"log_id": vitaminsID, "occurred_at": "2025-06-14T08:00:00Z"},
+			{"log_id": vitaminsID, "occurred_at": "2025-06-15T08:00:00Z"},
+			{"log_id": pushupsID, "fields": map[string]any{"count": "25"}},
+		},
+	}, cookies)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	entries := body["entries"].([]any)
+	require.Len(t, entries, 3)
+	e0 := entries[0].(map[string]any)
+	assert.Equal(t, vitaminsID, e0["log_id"])
+	assert.Equal(t, "2025-06-14T08:00:00Z", e0["occurred_at"])
+	assert.Equal(t, "alice", e0["username"])
+
+	_, vitaminEntries, _ := getEntryPage(srv.URL+"/api/logs/"+vitaminsID+"/entries", cookies)
+	assert.Len(t, vitaminEntries, 2)
+	_, pushupEntries, _ := getEntryPage(srv.URL+"/api/logs/"+pushupsID+"/entries", cookies)
+	assert.Len(t, pushupEntries, 1)
+}
+
+func TestBatchCreateLogEntries_InvalidItemInsertsNothing(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{
+		"name": "Pushups",
+		"fields": []map[string]any{
+			{"name": "count", "type": "number", "required": true},
+		},
+	}, cookies)
+	logID := created["id"].(string)
+
+	resp, body := postJSON(srv.URL+"/api/entries/batch", map[string]any{
+		"entries": []map[string]any{
+			{"log_id": logID, "fields": map[string]any{"count": "25"}},
+			{"log_id": logID, "fields": map[string]any{"count": "many"}},
+			{"log_id": logID, "fields": map[string]any{}},
+		},
+	}, cookies)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	errs := body["errors"].([]any)
+	require.Len(t, errs, 2)
+	assert.Equal(t, float64(1), errs[0].(map[string]any)["index"])
+	assert.Contains(t, errs[0].(map[string]any)["error"], "valid number")
+	assert.Equal(t, float64(2), errs[1].(map[string]any)["index"])
+	assert.Contains(t, errs[1].(map[string]any)["error"], "required")
+
+	_, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", cookies)
+	assert.Len(t, entries, 0)
+}
+
+func TestBatchCreateLogEntries_OtherUsersLog(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	aliceCookies := registerUser(t, srv.URL, "alice")
+	bobCookies := registerUser(t, srv.URL, "bob")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Alice Log"}, aliceCookies)
+	logID := created["id"].(string)
+
+	resp, body := postJSON(srv.URL+"/api/entries/batch", map[string]any{
+		"entries": []map[string]any{
+			{"log_id": logID},
+		},
+	}, bobCookies)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	errs := body["errors"].([]any)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "log not found", errs[0].(map[string]any)["error"])
+}
+
+func TestBatchCreateLogEntries_MalformedLogID(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Vitamins"}, cookies)
+	logID := created["id"].(string)
+
+	resp, body := postJSON(srv.URL+"/api/entries/batch", map[string]any{
+		"entries": []map[string]any{
+			{"log_id": logID},
+			{"log_id": "not-a-uuid"},
+		},
+	}, cookies)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	errs := body["errors"].([]any)
+	require.Len(t, errs, 1)
+	assert.Equal(t, 1.0, errs[0].(map[string]any)["index"])
+	assert.Equal(t, "log not found", errs[0].(map[string]any)["error"])
+
+	_, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", cookies)
+	assert.Empty(t, entries)
+}
+
+func TestBatchCreateLogEntries_Empty(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	resp, body := postJSON(srv.URL+"/api/entries/batch", map[string]any{"entries": []any{}}, cookies)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "empty")
+}
+
+func TestBatchCreateLogEntries_Unauthenticated(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	resp, _ := postJSON(srv.URL+"/api/entries/batch", map[string]any{"entries": []any{}}, nil)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,179 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type entryBucketsResponse struct {
+	Interval string        `json:"interval"`
+	TZ       string        `json:"tz"`
+	Field    string        `json:"field,omitempty"`
+	Buckets  []entryBucket `json:"buckets"`
+}
+
+type entryBucket struct {
+	// Start is the start of the bucket in the requested time zone and Date is
+	// its local date.
+	Start time.Time `json:"start"`
+	Date  string    `json:"date"`
+	Count int       `json:"count"`
+	// Field aggregates the values of the requested field in the bucket.
+	Field *bucketAggregates `json:"field,omitempty"`
+	// TrueRatios holds, for each boolean field with values in the bucket, the
+	// fraction of those values that are true.
+	TrueRatios map[string]float64 `json:"true_ratios,omitempty"`
+}
+
+type bucketAggregates struct {
+	Count int      `json:"count"`
+	Sum   *float64 `json:"sum"`
+	Min   *float64 `json:"min"`
+	Max   *float64 `json:"max"`
+	Mean  *float64 `json:"mean"`
+}
+
+// handleListEntryBuckets groups a log's entries into day, week or month
+// buckets by occurred_at in the time zone tz (default UTC) and returns the
+// entry count of each. Weeks start on Monday. With field set to a number,
+// duration or computed field it also aggregates that field's values, and each
+// bucket reports the ratio of true values of every boolean field. Only buckets
+// with entries are returned, oldest first. It accepts the same filters as
+// handleListLogEntries.
+func handleListEntryBuckets(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		logID := chi.URLParam(r, "logID")
+		query := r.URL.Query()
+
+		access, err := checkLogAccess(r.Context(), pool, logID, user.ID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		interval := query.Get("interval")
+		switch interval {
+		case "":
+			interval = "day"
+		case "day", "week", "month":
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "interval must be day, week or month"})
+			return
+		}
+
+		loc, err := loadTimeZone(query.Get("tz"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		var field *fieldDefinition
+		var booleans []fieldDefinition
+		for i, def := range access.Fields {
+			if def.Name == query.Get("field") {
+				field = &access.Fields[i]
+			}
+			if def.Type == "boolean" {
+				booleans = append(booleans, def)
+			}
+		}
+		if query.Get("field") != "" {
+			if field == nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown field: " + query.Get("field")})
+				return
+			}
+			if field.Type != "number" && field.Type != "duration" && field.Type != "computed" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("field %q must be a number, duration or computed field", field.Name)})
+				return
+			}
+		}
+
+		q := newEntryQuery(logID)
+		if err := applyEntryFilters(q, query, access.Fields); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		// Truncating the local wall clock time and converting the result back
+		// puts bucket boundaries at local midnight, even across DST changes.
+		tzArg := q.arg(loc.String()) + "::text"
+		bucket := "date_trunc(" + q.arg(interval) + "::text, le.occurred_at AT TIME ZONE " + tzArg + ") AT TIME ZONE " + tzArg
+		columns := []string{bucket, "count(*)"}
+		if field != nil {
+			v := numericFieldSQL(q.arg(field.Name)+"::text") + "::float8"
+			columns = append(columns, "count("+v+")", "sum("+v+")", "min("+v+")", "max("+v+")", "avg("+v+")")
+		}
+		for _, def := range booleans {
+			key := q.arg(def.Name) + "::text"
+			columns = append(columns,
+				"avg(CASE WHEN jsonb_typeof(le.fields->"+key+") = 'boolean' THEN (le.fields->>"+key+")::boolean::int END)::float8")
+		}
+
+		rows, err := pool.Query(r.Context(),
+			`SELECT `+strings.Join(columns, ", ")+`
+			 FROM log_entries le
+			 LEFT JOIN users u ON le.user_id = u.id
+			 WHERE `+q.whereSQL()+`
+			 GROUP BY 1
+			 ORDER BY 1`,
+			q.args...,
+		)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer rows.Close()
+
+		resp := entryBucketsResponse{Interval: interval, TZ: loc.String(), Buckets: []entryBucket{}}
+		if field != nil {
+			resp.Field = field.Name
+		}
+		for rows.Next() {
+			var b entryBucket
+			dest := []any{&b.Start, &b.Count}
+			if field != nil {
+				b.Field = &bucketAggregates{}
+				dest = append(dest, &b.Field.Count, &b.Field.Sum, &b.Field.Min, &b.Field.Max, &b.Field.Mean)
+			}
+			ratios := make([]*float64, len(booleans))
+			for i := range ratios {
+				dest = append(dest, &ratios[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+
+			b.Start = b.Start.In(loc)
+			b.Date = b.Start.Format(time.DateOnly)
+			for i, ratio := range ratios {
+				if ratio == nil {
+					continue
+				}
+				if b.TrueRatios == nil {
+					b.TrueRatios = make(map[string]float64)
+				}
+				b.TrueRatios[booleans[i].Name] = *ratio
+			}
+			resp.Buckets = append(resp.Buckets, b)
+		}
+		if rows.Err() != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,86 @@
+package backend
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListEntryBuckets(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{
+		"name": "Pushups",
+		"fields": []map[string]any{
+			{"name": "reps", "type": "number"},
+			{"name": "outside", "type": "boolean"},
+			{"name": "notes", "type": "text"},
+		},
+	}, cookies)
+	logID := created["id"].(string)
+
+	for _, e := range []struct {
+		occurredAt string
+		reps       string
+		outside    bool
+	}{
+		// 23:30 on March 8 in New York, the night DST starts.
+		{"2025-03-09T04:30:00Z", "10", true},
+		// 00:30 on March 9 in New York, but still March 9 in UTC.
+		{"2025-03-09T05:30:00Z", "20", false},
+		{"2025-03-09T23:00:00Z", "30", false},
+		{"2025-03-10T04:30:00Z", "", true},
+	} {
+		resp, _ := postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{
+			"fields":      map[string]any{"reps": e.reps, "outside": e.outside},
+			"occurred_at": e.occurredAt,
+		}, cookies)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	resp, body := getJSON(srv.URL+"/api/logs/"+logID+"/buckets?interval=day&tz=America/New_York&field=reps", cookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "reps", body["field"])
+	buckets := body["buckets"].([]any)
+	require.Len(t, buckets, 3)
+
+	first := buckets[0].(map[string]any)
+	assert.Equal(t, "2025-03-08", first["date"])
+	assert.Equal(t, "2025-03-08T00:00:00-05:00", first["start"])
+	assert.Equal(t, 1.0, first["count"])
+
+	second := buckets[1].(map[string]any)
+	assert.Equal(t, "2025-03-09T00:00:00-05:00", second["start"])
+	assert.Equal(t, 2.0, second["count"])
+	assert.Equal(t, map[string]any{"count": 2.0, "sum": 50.0, "min": 20.0, "max": 30.0, "mean": 25.0}, second["field"])
+	assert.Equal(t, map[string]any{"outside": 0.0}, second["true_ratios"])
+
+	// The day after DST starts begins at midnight EDT.
+	third := buckets[2].(map[string]any)
+	assert.Equal(t, "2025-03-10T00:00:00-04:00", third["start"])
+	assert.Equal(t, 0.0, third["field"].(map[string]any)["count"])
+	assert.Nil(t, third["field"].(map[string]any)["sum"])
+
+	resp, body = getJSON(srv.URL+"/api/logs/"+logID+"/buckets?interval=month", cookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	buckets = body["buckets"].([]any)
+	require.Len(t, buckets, 1)
+	month := buckets[0].(map[string]any)
+	assert.Equal(t, "2025-03-01T00:00:00Z", month["start"])
+	assert.Equal(t, 4.0, month["count"])
+	assert.Nil(t, month["field"])
+	assert.Equal(t, map[string]any{"outside": 0.5}, month["true_ratios"])
+
+	resp, _ = getJSON(srv.URL+"/api/logs/"+logID+"/buckets?interval=year", cookies)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = getJSON(srv.URL+"/api/logs/"+logID+"/buckets?field=notes", cookies)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, body = getJSON(srv.URL+"/api/logs/"+logID+"/buckets?tz=Local", cookies)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "tz")
+}
@@ -0,0 +1,439 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const maxExpressionLength = 500
+
+// exprNode is a node of a parsed computed field expression.
+type exprNode interface {
+	// eval returns the value of the node given the numeric values of the
+	// entry's fields. ok is false if a referenced field has no value or the
+	// result is not a finite number, such as after a division by zero.
+	eval(values map[string]float64) (v float64, ok bool)
+	// refs appends the names of the fields the node refers to.
+	refs(names []string) []string
+}
+
+type exprNumber float64
+
+func (n exprNumber) eval(map[string]float64) (float64, bool) { return float64(n), true }
+func (n exprNumber) refs(names []string) []string            { return names }
+
+type exprField string
+
+func (f exprField) eval(values map[string]float64) (float64, bool) {
+	v, ok := values[string(f)]
+	return v, ok
+}
+
+func (f exprField) refs(names []string) []string { return append(names, string(f)) }
+
+type exprNegate struct{ x exprNode }
+
+func (e exprNegate) eval(values map[string]float64) (float64, bool) {
+	v, ok := e.x.eval(values)
+	return -v, ok
+}
+
+func (e exprNegate) refs(names []string) []string { return e.x.refs(names) }
+
+type exprBinary struct {
+	op   byte
+	l, r exprNode
+}
+
+func (e exprBinary) eval(values map[string]float64) (float64, bool) {
+	l, ok := e.l.eval(values)
+	if !ok {
+		return 0, false
+	}
+	r, ok := e.r.eval(values)
+	if !ok {
+		return 0, false
+	}
+	var v float64
+	switch e.op {
+	case '+':
+		v = l + r
+	case '-':
+		v = l - r
+	case '*':
+		v = l * r
+	case '/':
+		v = l / r
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+func (e exprBinary) refs(names []string) []string { return e.r.refs(e.l.refs(names)) }
+
+// parseExpression parses the expression of a computed field. Expressions
+// combine numbers and field references with +, -, *, / and parentheses. A
+// field is referenced by its name, which must be double quoted unless it
+// consists only of ASCII letters, digits and underscores and does not start
+// with a digit.
+func parseExpression(s string) (exprNode, error) {
+	p := &exprParser{s: s}
+	n, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.s[p.pos], p.pos+1)
+	}
+	return n, nil
+}
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end of the expression.
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	n, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		n = exprBinary{op: op, l: n, r: r}
+	}
+	return n, nil
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	n, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		r, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		n = exprBinary{op: op, l: n, r: r}
+	}
+	return n, nil
+}
+
+func (p *exprParser) parseFactor() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '-':
+		p.pos++
+		x, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return exprNegate{x: x}, nil
+	case c == '(':
+		p.pos++
+		n, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return n, nil
+	case c == '"':
+		end := strings.IndexByte(p.s[p.pos+1:], '"')
+		if end < 0 {
+			return nil, fmt.Errorf("missing closing quote")
+		}
+		name := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return exprField(name), nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.s) && (p.s[p.pos] == '.' || (p.s[p.pos] >= '0' && p.s[p.pos] <= '9')) {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.s[start:p.pos])
+		}
+		return exprNumber(n), nil
+	case isNameStart(c):
+		start := p.pos
+		for p.pos < len(p.s) && (isNameStart(p.s[p.pos]) || (p.s[p.pos] >= '0' && p.s[p.pos] <= '9')) {
+			p.pos++
+		}
+		return exprField(p.s[start:p.pos]), nil
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// validateComputedFields checks the expressions of the computed fields in
+// fields. Expressions may only refer to number and duration fields of the
+// same log.
+func validateComputedFields(fields []fieldDefinition) error {
+	byName := make(map[string]fieldDefinition, len(fields))
+	for _, f := range fields {
+		byName[f.Name] = f
+	}
+
+	for i, f := range fields {
+		if f.Type != "computed" {
+			if f.Expression != "" {
+				return fmt.Errorf("field %q: expression is only allowed on computed fields", f.Name)
+			}
+			continue
+		}
+		if f.Required {
+			return fmt.Errorf("field %q: computed fields cannot be required", f.Name)
+		}
+
+		expression := strings.TrimSpace(f.Expression)
+		fields[i].Expression = expression
+		if expression == "" {
+			return fmt.Errorf("field %q: computed fields must have an expression", f.Name)
+		}
+		if len(expression) > maxExpressionLength {
+			return fmt.Errorf("field %q: expression must be at most %d characters", f.Name, maxExpressionLength)
+		}
+		n, err := parseExpression(expression)
+		if err != nil {
+			return fmt.Errorf("field %q: invalid expression: %w", f.Name, err)
+		}
+		for _, name := range n.refs(nil) {
+			ref, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("field %q: expression refers to unknown field %q", f.Name, name)
+			}
+			if ref.Type != "number" && ref.Type != "duration" {
+				return fmt.Errorf("field %q: expression may only refer to number and duration fields", f.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// renameExpressionFields updates the expressions of the computed fields in
+// next that refer to fields renamed since previous, so renaming a field keeps
+// the expressions that use it valid. Fields are matched by ID, so
+// assignFieldIDs must be called first. An expression edited in the same update
+// is left as sent.
+func renameExpressionFields(previous, next []fieldDefinition) {
+	prevByID := make(map[string]fieldDefinition, len(previous))
+	for _, d := range previous {
+		prevByID[d.ID] = d
+	}
+
+	renames := make(map[string]string)
+	for _, d := range next {
+		prev, ok := prevByID[d.ID]
+		if name := strings.TrimSpace(d.Name); ok && prev.Name != name {
+			renames[prev.Name] = name
+		}
+	}
+	if len(renames) == 0 {
+		return
+	}
+
+	for i, d := range next {
+		prev, ok := prevByID[d.ID]
+		if d.Type != "computed" || !ok || strings.TrimSpace(d.Expression) != prev.Expression {
+			continue
+		}
+		next[i].Expression = renameExpressionRefs(prev.Expression, renames)
+	}
+}
+
+// renameExpressionRefs returns expression with each field reference named in
+// renames replaced by the new name, quoted if needed. The rest of the
+// expression is kept as written.
+func renameExpressionRefs(expression string, renames map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(expression); {
+		var name string
+		end := i
+		switch c := expression[i]; {
+		case c == '"':
+			j := strings.IndexByte(expression[i+1:], '"')
+			if j < 0 {
+				end = len(expression)
+				break
+			}
+			name = expression[i+1 : i+1+j]
+			end = i + j + 2
+		case isNameStart(c):
+			end = i + 1
+			for end < len(expression) && (isNameStart(expression[end]) || (expression[end] >= '0' && expression[end] <= '9')) {
+				end++
+			}
+			name = expression[i:end]
+		default:
+			end = i + 1
+		}
+
+		if newName, ok := renames[name]; ok && name != "" {
+			b.WriteString(formatExpressionRef(newName))
+		} else {
+			b.WriteString(expression[i:end])
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// formatExpressionRef returns the reference to the field name in an
+// expression, which is double quoted unless name is a plain identifier.
+func formatExpressionRef(name string) string {
+	plain := name != "" && isNameStart(name[0])
+	for i := 0; i < len(name) && plain; i++ {
+		plain = isNameStart(name[i]) || (name[i] >= '0' && name[i] <= '9')
+	}
+	if plain {
+		return name
+	}
+	return `"` + name + `"`
+}
+
+// computeFieldValues sets the value of each computed field in definitions
+// from the other values of the entry, replacing any value given for it.
+// Durations take part in seconds. A computed field is left without a value
+// if a field it refers to has none or the result is not a finite number.
+func computeFieldValues(definitions []fieldDefinition, values map[string]any) {
+	var numbers map[string]float64
+	for _, def := range definitions {
+		if def.Type != "computed" {
+			continue
+		}
+		if numbers == nil {
+			numbers = numericFieldValues(definitions, values)
+		}
+
+		delete(values, def.Name)
+		n, err := parseExpression(def.Expression)
+		if err != nil {
+			continue
+		}
+		if v, ok := n.eval(numbers); ok {
+			// Round away floating point noise such as 0.30000000000000004.
+			v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+			values[def.Name] = v
+		}
+	}
+}
+
+// numericFieldValues returns the values of the number and duration fields in
+// values that have one.
+func numericFieldValues(definitions []fieldDefinition, values map[string]any) map[string]float64 {
+	numbers := make(map[string]float64)
+	for _, def := range definitions {
+		if def.Type != "number" && def.Type != "duration" {
+			continue
+		}
+		switch v := values[def.Name].(type) {
+		case float64:
+			numbers[def.Name] = v
+		case string:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				numbers[def.Name] = n
+			}
+		}
+	}
+	return numbers
+}
+
+// computedFieldsChanged reports whether updating a log's field definitions
+// from previous to next requires its computed values to be recomputed.
+func computedFieldsChanged(previous, next []fieldDefinition, changes []*fieldChange) bool {
+	prevByID := make(map[string]fieldDefinition, len(previous))
+	for _, d := range previous {
+		prevByID[d.ID] = d
+	}
+	for _, d := range next {
+		if d.Type != "computed" {
+			continue
+		}
+		// A field the expression refers to may have been renamed or changed
+		// type.
+		if len(changes) > 0 {
+			return true
+		}
+		prev, ok := prevByID[d.ID]
+		if !ok || prev.Type != d.Type || prev.Expression != d.Expression {
+			return true
+		}
+	}
+	return false
+}
+
+// recomputeEntryFields recomputes the computed fields of every entry in logID
+// using definitions.
+func recomputeEntryFields(ctx context.Context, tx pgx.Tx, logID string, definitions []fieldDefinition) error {
+	rows, err := tx.Query(ctx, `SELECT id, fields FROM log_entries WHERE log_id = $1 FOR UPDATE`, logID)
+	if err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	for rows.Next() {
+		var id string
+		var fields map[string]any
+		if err := rows.Scan(&id, &fields); err != nil {
+			rows.Close()
+			return err
+		}
+		computed := maps.Clone(fields)
+		if computed == nil {
+			computed = map[string]any{}
+		}
+		computeFieldValues(definitions, computed)
+		if !reflect.DeepEqual(fields, computed) {
+			batch.Queue(`UPDATE log_entries SET fields = $1 WHERE id = $2`, computed, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
@@ -0,0 +1,106 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpression(t *testing.T) {
+	values := map[string]float64{"sets": 3, "reps": 12, "distance km": 5, "time": 1500}
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"sets * reps", 36},
+		{"sets + reps * 2", 27},
+		{"(sets + reps) * 2", 30},
+		{"-sets + 10", 7},
+		{"reps / sets / 2", 2},
+		{"time / 60 / \"distance km\"", 5},
+		{"0.1 * 3", 0.30000000000000004},
+	}
+	for _, tt := range tests {
+		n, err := parseExpression(tt.expr)
+		require.NoError(t, err, tt.expr)
+		got, ok := n.eval(values)
+		require.True(t, ok, tt.expr)
+		assert.Equal(t, tt.want, got, tt.expr)
+	}
+
+	for _, bad := range []string{"", "sets *", "(sets", "sets reps", "\"sets", "1.2.3", "sets % 2"} {
+		_, err := parseExpression(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestValidateFieldDefinitions_Computed(t *testing.T) {
+	fields := []fieldDefinition{
+		{Name: "total", Type: "computed", Expression: " sets * reps "},
+		{Name: "sets", Type: "number"},
+		{Name: "reps", Type: "number"},
+	}
+	require.NoError(t, validateFieldDefinitions(fields))
+	assert.Equal(t, "sets * reps", fields[0].Expression)
+
+	tests := []struct {
+		fields  []fieldDefinition
+		wantErr string
+	}{
+		{[]fieldDefinition{{Name: "total", Type: "computed"}}, "must have an expression"},
+		{[]fieldDefinition{{Name: "total", Type: "computed", Expression: "sets *"}}, "invalid expression"},
+		{[]fieldDefinition{{Name: "total", Type: "computed", Expression: "sets"}}, "unknown field \"sets\""},
+		{[]fieldDefinition{{Name: "total", Type: "computed", Expression: "notes"}, {Name: "notes", Type: "text"}}, "only refer to number and duration"},
+		{[]fieldDefinition{{Name: "total", Type: "computed", Expression: "total + 1"}}, "only refer to number and duration"},
+		{[]fieldDefinition{{Name: "total", Type: "computed", Expression: "1", Required: true}}, "cannot be required"},
+		{[]fieldDefinition{{Name: "total", Type: "number", Expression: "1"}}, "only allowed on computed"},
+	}
+	for _, tt := range tests {
+		err := validateFieldDefinitions(tt.fields)
+		assert.ErrorContains(t, err, tt.wantErr)
+	}
+}
+
+func TestRenameExpressionFields(t *testing.T) {
+	previous := []fieldDefinition{
+		{ID: "a", Name: "sets", Type: "number"},
+		{ID: "b", Name: "rep count", Type: "number"},
+		{ID: "c", Name: "total", Type: "computed", Expression: `sets * "rep count" + sets2`},
+		{ID: "d", Name: "double", Type: "computed", Expression: "sets * 2"},
+	}
+	next := []fieldDefinition{
+		{ID: "a", Name: "set count", Type: "number"},
+		{ID: "b", Name: " reps ", Type: "number"},
+		{ID: "c", Name: "total", Type: "computed", Expression: `sets * "rep count" + sets2`},
+		{ID: "d", Name: "double", Type: "computed", Expression: "sets * 3"},
+	}
+	renameExpressionFields(previous, next)
+	assert.Equal(t, `"set count" * reps + sets2`, next[2].Expression)
+	// An expression edited in the same update is left as sent.
+	assert.Equal(t, "sets * 3", next[3].Expression)
+
+	// Swapped names are renamed together.
+	assert.Equal(t, "b - a", renameExpressionRefs("a - b", map[string]string{"a": "b", "b": "a"}))
+	assert.Equal(t, `x + "unterminated`, renameExpressionRefs(`a + "unterminated`, map[string]string{"a": "x"}))
+}
+
+func TestValidateFieldValues_Computed(t *testing.T) {
+	defs := []fieldDefinition{
+		{Name: "distance", Type: "number"},
+		{Name: "time", Type: "duration"},
+		{Name: "pace", Type: "computed", Expression: "time / 60 / distance"},
+	}
+
+	values := map[string]any{"distance": "5", "time": "25m", "pace": 1.0}
+	require.NoError(t, validateFieldValues(defs, values))
+	assert.Equal(t, 5.0, values["pace"])
+
+	// Missing operands and division by zero leave no value.
+	values = map[string]any{"time": "25m"}
+	require.NoError(t, validateFieldValues(defs, values))
+	assert.NotContains(t, values, "pace")
+	values = map[string]any{"distance": "0", "time": "25m"}
+	require.NoError(t, validateFieldValues(defs, values))
+	assert.NotContains(t, values, "pace")
+}
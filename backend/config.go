@@ -13,6 +13,9 @@ type Config struct {
 	AllowRegistration bool
 	WebAuthnRPID      string
 	WebAuthnOrigin    string
+	// ReminderWebhookURL is where reminders are posted. Without it reminders
+	// are written to the server log.
+	ReminderWebhookURL string
 }
 
 func DefaultConfig() Config {
@@ -62,6 +65,8 @@ func LoadConfigFile(path string) (Config, error) {
 			cfg.WebAuthnRPID = value
 		case "webauthn_origin":
 			cfg.WebAuthnOrigin = value
+		case "reminder_webhook_url":
+			cfg.ReminderWebhookURL = value
 		}
 	}
 	return cfg, scanner.Err()
@@ -72,7 +72,7 @@ func TestLoadConfigFile_AllKeys(t *testing.T) {
 	require.NoError(t, err)
 	defer os.Remove(f.Name())
 
-	f.WriteString("database_url=postgres://localhost/mydb\nlisten_address=:8080\nallow_registration=true\n")
+	f.WriteString("database_url=postgres://localhost/mydb\nlisten_address=:8080\nallow_registration=true\nreminder_webhook_url=https://example.com/hook\n")
 	f.Close()
 
 	cfg, err := LoadConfigFile(f.Name())
@@ -80,6 +80,7 @@ func TestLoadConfigFile_AllKeys(t *testing.T) {
 	assert.Equal(t, "postgres://localhost/mydb", cfg.DatabaseURL)
 	assert.Equal(t, ":8080", cfg.ListenAddress)
 	assert.True(t, cfg.AllowRegistration)
+	assert.Equal(t, "https://example.com/hook", cfg.ReminderWebhookURL)
 }
 
 func TestLoadConfigFile_FileNotFound(t *testing.T) {
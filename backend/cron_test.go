@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronSchedule_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		_, err := parseCronSchedule(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tests := []struct {
+		schedule string
+		after    time.Time
+		want     time.Time
+	}{
+		{"*/15 * * * *", time.Date(2025, 3, 5, 10, 7, 30, 0, time.UTC), time.Date(2025, 3, 5, 10, 15, 0, 0, time.UTC)},
+		{"0 8 * * *", time.Date(2025, 3, 5, 8, 0, 0, 0, time.UTC), time.Date(2025, 3, 6, 8, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2025, 3, 7, 10, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 12, 15, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 9, 12, 0, 0, 0, time.UTC)},
+		{"0 8-18/4 * * *", time.Date(2025, 3, 5, 13, 0, 0, 0, time.UTC), time.Date(2025, 3, 5, 16, 0, 0, 0, time.UTC)},
+		// Day of month and day of week both restricted match either one.
+		{"0 0 13 * 5", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 7, 0, 0, 0, 0, time.UTC)},
+		// Schedules follow the wall clock across DST changes.
+		{"0 8 * * *", time.Date(2025, 3, 8, 9, 0, 0, 0, ny), time.Date(2025, 3, 9, 8, 0, 0, 0, ny)},
+		// 2:30 does not exist on the day DST starts.
+		{"30 2 * * *", time.Date(2025, 3, 8, 3, 0, 0, 0, ny), time.Date(2025, 3, 10, 2, 30, 0, 0, ny)},
+		{"0 0 30 2 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := parseCronSchedule(tt.schedule)
+		require.NoError(t, err, tt.schedule)
+		got := c.next(tt.after)
+		assert.True(t, tt.want.Equal(got), "%s after %v: got %v, want %v", tt.schedule, tt.after, got, tt.want)
+	}
+}
@@ -0,0 +1,129 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// validateFieldDefault checks the default settings of the field def and
+// normalizes its default value the way an entry value would be stored.
+func validateFieldDefault(def *fieldDefinition) error {
+	if def.Type == "computed" && (def.Default != nil || def.UseLastValue) {
+		return fmt.Errorf("field %q: computed fields cannot have a default", def.Name)
+	}
+	if def.Default == nil {
+		return nil
+	}
+	if def.UseLastValue {
+		return fmt.Errorf("field %q: default and use_last_value cannot both be set", def.Name)
+	}
+
+	d := *def
+	d.Required = false
+	d.Archived = false
+	values := map[string]any{d.Name: d.Default}
+	if err := validateFieldValues([]fieldDefinition{d}, values); err != nil {
+		return fmt.Errorf("field %q: invalid default: %w", def.Name, err)
+	}
+	if isBlankFieldValue(values[d.Name]) {
+		return fmt.Errorf("field %q: default must not be empty", def.Name)
+	}
+	def.Default = values[d.Name]
+	return nil
+}
+
+func isBlankFieldValue(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []string:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// resolveFieldDefaults returns the default value of each field in definitions
+// that has one, keyed by field name. A field that uses its last value defaults
+// to the value in userID's most recent entry in logID that has one, as long as
+// that value is still valid for the field.
+func resolveFieldDefaults(ctx context.Context, pool *pgxpool.Pool, logID, userID string, definitions []fieldDefinition) (map[string]any, error) {
+	defaults := make(map[string]any)
+	var lastValueNames []string
+	for _, def := range definitions {
+		if def.Archived {
+			continue
+		}
+		if def.Default != nil {
+			defaults[def.Name] = def.Default
+		} else if def.UseLastValue {
+			lastValueNames = append(lastValueNames, def.Name)
+		}
+	}
+	if len(lastValueNames) == 0 {
+		return defaults, nil
+	}
+
+	rows, err := pool.Query(ctx,
+		`SELECT n.name, (
+			SELECT le.fields -> n.name FROM log_entries le
+			WHERE le.log_id = $1 AND le.user_id = $2 AND le.fields ? n.name
+			ORDER BY le.occurred_at DESC, le.id DESC
+			LIMIT 1
+		 )
+		 FROM unnest($3::text[]) AS n(name)`,
+		logID, userID, lastValueNames,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lastValues := make(map[string]any)
+	for rows.Next() {
+		var name string
+		var v any
+		if err := rows.Scan(&name, &v); err != nil {
+			return nil, err
+		}
+		if v != nil {
+			lastValues[name] = v
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, def := range definitions {
+		v, ok := lastValues[def.Name]
+		if !ok {
+			continue
+		}
+		// The field may have changed since the value was recorded, for
+		// example by retiring the chosen option.
+		d := def
+		d.Required = false
+		values := map[string]any{d.Name: v}
+		if err := validateFieldValues([]fieldDefinition{d}, values); err != nil || isBlankFieldValue(values[d.Name]) {
+			continue
+		}
+		defaults[def.Name] = values[d.Name]
+	}
+	return defaults, nil
+}
+
+// applyFieldDefaults sets each field missing from values, or left blank, to
+// its default.
+func applyFieldDefaults(values, defaults map[string]any) {
+	for name, v := range defaults {
+		if isBlankFieldValue(values[name]) {
+			values[name] = v
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFieldDefinitions_Defaults(t *testing.T) {
+	fields := []fieldDefinition{
+		{Name: "dose", Type: "text", Required: true, Default: "500mg"},
+		{Name: "time", Type: "duration", Default: "PT20M"},
+		{Name: "mood", Type: "select", Default: "good", Options: []selectOption{{ID: "good", Label: "Good"}}},
+		{Name: "weight", Type: "number", UseLastValue: true},
+	}
+	require.NoError(t, validateFieldDefinitions(fields))
+	assert.Equal(t, "500mg", fields[0].Default)
+	assert.Equal(t, 1200.0, fields[1].Default)
+
+	tests := []struct {
+		field   fieldDefinition
+		wantErr string
+	}{
+		{fieldDefinition{Name: "n", Type: "number", Default: "lots"}, "invalid default"},
+		{fieldDefinition{Name: "n", Type: "number", Max: ptr(10.0), Default: "11"}, "at most 10"},
+		{fieldDefinition{Name: "n", Type: "text", Default: " "}, "must not be empty"},
+		{fieldDefinition{Name: "n", Type: "text", Default: "a", UseLastValue: true}, "cannot both be set"},
+		{fieldDefinition{Name: "n", Type: "select", Default: "old", Options: []selectOption{{ID: "old", Label: "Old", Retired: true}}}, "retired"},
+	}
+	for _, tt := range tests {
+		err := validateFieldDefinitions([]fieldDefinition{tt.field})
+		assert.ErrorContains(t, err, tt.wantErr)
+	}
+}
+
+func TestApplyFieldDefaults(t *testing.T) {
+	values := map[string]any{"dose": "250mg", "notes": nil, "brand": " ", "fasted": false}
+	applyFieldDefaults(values, map[string]any{"dose": "500mg", "notes": "none", "count": "1", "brand": "Acme", "fasted": true})
+	assert.Equal(t, map[string]any{"dose": "250mg", "notes": "none", "count": "1", "brand": "Acme", "fasted": false}, values)
+}
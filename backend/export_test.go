@@ -0,0 +1,139 @@
+package backend
+
+import (
+	"encoding/csv"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getCSV(t *testing.T, url string, cookies []*http.Cookie) (*http.Response, [][]string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	require.NoError(t, err)
+	return resp, records
+}
+
+func TestExportLogEntriesCSV_Success(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{
+		"name": "Pushups",
+		"fields": []map[string]any{
+			{"name": "count", "type": "number", "required": true},
+			{"name": "notes", "type": "text"},
+			{"name": "fasted", "type": "boolean"},
+		},
+	}, cookies)
+	logID := created["id"].(string)
+
+	postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{
+		"fields":      map[string]any{"count": "25", "notes": "felt strong, mostly", "fasted": true},
+		"occurred_at": "2025-06-15T10:30:00Z",
+	}, cookies)
+	postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{
+		"fields":      map[string]any{"count": "30"},
+		"occurred_at": "2025-06-14T10:30:00Z",
+	}, cookies)
+
+	resp, records := getCSV(t, srv.URL+"/api/logs/"+logID+"/entries.csv", cookies)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "Pushups.csv")
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"occurred_at", "username", "count", "notes", "fasted"}, records[0])
+	assert.Equal(t, []string{"2025-06-14T10:30:00Z", "alice", "30", "", ""}, records[1])
+	assert.Equal(t, []string{"2025-06-15T10:30:00Z", "alice", "25", "felt strong, mostly", "true"}, records[2])
+}
+
+func TestExportLogEntriesCSV_TimeZone(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Vitamins"}, cookies)
+	logID := created["id"].(string)
+
+	postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{
+		"occurred_at": "2025-06-15T10:30:00Z",
+	}, cookies)
+
+	_, records := getCSV(t, srv.URL+"/api/logs/"+logID+"/entries.csv?tz=America/Chicago", cookies)
+
+	require.Len(t, records, 2)
+	assert.Equal(t, "2025-06-15T05:30:00-05:00", records[1][0])
+}
+
+func TestExportLogEntriesCSV_EscapesFormulas(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{
+		"name": "Notes",
+		"fields": []map[string]any{
+			{"name": "note", "type": "text"},
+		},
+	}, cookies)
+	logID := created["id"].(string)
+
+	postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{
+		"fields": map[string]any{"note": "=SUM(A1:A2)"},
+	}, cookies)
+
+	_, records := getCSV(t, srv.URL+"/api/logs/"+logID+"/entries.csv", cookies)
+
+	require.Len(t, records, 2)
+	assert.Equal(t, "'=SUM(A1:A2)", records[1][2])
+}
+
+func TestExportLogEntriesCSV_OtherUsersLog(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	aliceCookies := registerUser(t, srv.URL, "alice")
+	bobCookies := registerUser(t, srv.URL, "bob")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Alice Log"}, aliceCookies)
+	logID := created["id"].(string)
+
+	resp, _ := getCSV(t, srv.URL+"/api/logs/"+logID+"/entries.csv", bobCookies)
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestFormatCSVFieldValue(t *testing.T) {
+	text := fieldDefinition{Name: "notes", Type: "text"}
+	number := fieldDefinition{Name: "count", Type: "number"}
+
+	assert.Equal(t, "", formatCSVFieldValue(text, nil))
+	assert.Equal(t, "true", formatCSVFieldValue(fieldDefinition{Type: "boolean"}, true))
+	assert.Equal(t, "hello", formatCSVFieldValue(text, "hello"))
+	assert.Equal(t, "'@cmd", formatCSVFieldValue(text, "@cmd"))
+	assert.Equal(t, "-5", formatCSVFieldValue(number, "-5"))
+	assert.Equal(t, "1209600", formatCSVFieldValue(fieldDefinition{Type: "duration"}, 1209600.0))
+
+	tags := fieldDefinition{Name: "tags", Type: "multiselect", Options: []selectOption{
+		{ID: "a", Label: "Morning"},
+		{ID: "b", Label: "Outdoors"},
+	}}
+	assert.Equal(t, "Morning, Outdoors", formatCSVFieldValue(tags, []any{"a", "b"}))
+}
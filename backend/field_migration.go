@@ -0,0 +1,286 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fieldChange describes how an update to a log's field definitions affects a
+// field that existed before the update. Entry values are keyed by field name,
+// so renames, deletions and type changes must be applied to every entry.
+type fieldChange struct {
+	FieldID string `json:"field_id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Deleted bool   `json:"deleted,omitempty"`
+	NewName string `json:"new_name,omitempty"`
+	NewType string `json:"new_type,omitempty"`
+	// EntriesAffected counts the entries that hold a value for the field.
+	EntriesAffected int `json:"entries_affected"`
+	// Unconvertible counts the values that cannot be converted to NewType.
+	Unconvertible int `json:"unconvertible,omitempty"`
+	// Failures lists up to maxReportedConversionFailures of the values that
+	// cannot be converted.
+	Failures []conversionFailure `json:"failures,omitempty"`
+
+	from fieldDefinition
+	to   fieldDefinition
+}
+
+// conversionFailure is an entry value that cannot be converted to its field's
+// new type.
+type conversionFailure struct {
+	EntryID string `json:"entry_id"`
+	Value   any    `json:"value"`
+	Error   string `json:"error"`
+}
+
+const maxReportedConversionFailures = 20
+
+// What to do with entry values that cannot be converted to a field's new type.
+const (
+	// conversionAbort rejects the update.
+	conversionAbort = "abort"
+	// conversionDrop removes the values from their entries.
+	conversionDrop = "drop"
+	// conversionKeep moves the values to the entry's unconverted_fields, keyed
+	// by field ID, so they are not lost.
+	conversionKeep = "keep"
+)
+
+func validateConversionMode(mode string) error {
+	switch mode {
+	case conversionAbort, conversionDrop, conversionKeep:
+		return nil
+	}
+	return fmt.Errorf("on_conversion_error must be abort, drop or keep")
+}
+
+// planFieldMigration compares the field definitions of a log before and after
+// an update, matching fields by ID, and returns the changes that require
+// entry data to be migrated.
+func planFieldMigration(previous, next []fieldDefinition) []*fieldChange {
+	nextByID := make(map[string]fieldDefinition, len(next))
+	for _, d := range next {
+		nextByID[d.ID] = d
+	}
+
+	var changes []*fieldChange
+	for _, prev := range previous {
+		c := &fieldChange{FieldID: prev.ID, Name: prev.Name, Type: prev.Type, from: prev}
+		d, ok := nextByID[prev.ID]
+		if !ok {
+			c.Deleted = true
+			changes = append(changes, c)
+			continue
+		}
+		c.to = d
+		if d.Name != prev.Name {
+			c.NewName = d.Name
+		}
+		if d.Type != prev.Type {
+			c.NewType = d.Type
+		}
+		if c.NewName != "" || c.NewType != "" {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// fieldConversionError reports entry values that could not be converted to a
+// field's new type.
+type fieldConversionError struct {
+	Field   string
+	Type    string
+	Entries int
+}
+
+func (e *fieldConversionError) Error() string {
+	return fmt.Sprintf("%d entries have values for field %q that cannot be converted to %s", e.Entries, e.Field, e.Type)
+}
+
+// fieldDeletionError reports that a field being deleted still holds values
+// and the deletion was not confirmed.
+type fieldDeletionError struct {
+	Field   string
+	Entries int
+}
+
+func (e *fieldDeletionError) Error() string {
+	return fmt.Sprintf("%d entries have values for deleted field %q; set confirm_delete to delete them", e.Entries, e.Field)
+}
+
+// migrateEntryFields applies changes to the fields of every entry in logID
+// and fills in the number of entries affected by each change and the values
+// that cannot be converted. When apply is false nothing is written, which
+// previews the migration. Values that cannot be converted to their field's
+// new type are handled according to mode. With conversionAbort a
+// *fieldConversionError is returned and nothing is written. Unless
+// confirmDelete is set, deleting a field other than a computed field that
+// holds values returns a *fieldDeletionError and nothing is written.
+func migrateEntryFields(ctx context.Context, tx pgx.Tx, logID string, changes []*fieldChange, mode string, confirmDelete, apply bool) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(changes))
+	var deletedIDs []string
+	for i, c := range changes {
+		keys[i] = c.Name
+		if c.Deleted {
+			deletedIDs = append(deletedIDs, c.FieldID)
+		}
+	}
+
+	// Entry writes hold a share lock on the log row (see lockLogFields), so
+	// none can be in progress while the caller holds it for update. Locking
+	// the entries as well keeps them from being deleted mid-migration.
+	rows, err := tx.Query(ctx,
+		`SELECT id, fields, unconverted_fields FROM log_entries WHERE log_id = $1 AND fields ?| $2::text[] FOR UPDATE`,
+		logID, keys,
+	)
+	if err != nil {
+		return err
+	}
+
+	type migratedEntry struct {
+		id          string
+		fields      map[string]any
+		unconverted map[string]any
+	}
+	var updates []migratedEntry
+	for rows.Next() {
+		var id string
+		var fields, unconverted map[string]any
+		if err := rows.Scan(&id, &fields, &unconverted); err != nil {
+			rows.Close()
+			return err
+		}
+
+		migrated := maps.Clone(fields)
+		for _, c := range changes {
+			delete(migrated, c.Name)
+		}
+		for _, c := range changes {
+			v, ok := fields[c.Name]
+			if !ok {
+				continue
+			}
+			c.EntriesAffected++
+			if c.Deleted {
+				continue
+			}
+			if c.NewType != "" {
+				converted, err := convertFieldValue(c.from, c.to, v)
+				if err != nil {
+					c.Unconvertible++
+					if len(c.Failures) < maxReportedConversionFailures {
+						c.Failures = append(c.Failures, conversionFailure{EntryID: id, Value: v, Error: err.Error()})
+					}
+					if mode == conversionKeep {
+						if unconverted == nil {
+							unconverted = map[string]any{}
+						}
+						unconverted[c.FieldID] = v
+					}
+					continue
+				}
+				if converted == nil {
+					continue
+				}
+				v = converted
+			}
+			migrated[c.to.Name] = v
+		}
+		for _, fieldID := range deletedIDs {
+			delete(unconverted, fieldID)
+		}
+		updates = append(updates, migratedEntry{id: id, fields: migrated, unconverted: unconverted})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !apply {
+		return nil
+	}
+	if !confirmDelete {
+		for _, c := range changes {
+			if c.Deleted && c.Type != "computed" && c.EntriesAffected > 0 {
+				return &fieldDeletionError{Field: c.Name, Entries: c.EntriesAffected}
+			}
+		}
+	}
+	if mode == conversionAbort {
+		for _, c := range changes {
+			if c.Unconvertible > 0 {
+				return &fieldConversionError{Field: c.Name, Type: c.NewType, Entries: c.Unconvertible}
+			}
+		}
+	}
+
+	batch := &pgx.Batch{}
+	for _, u := range updates {
+		batch.Queue(`UPDATE log_entries SET fields = $1, unconverted_fields = $2 WHERE id = $3`, u.fields, u.unconverted, u.id)
+	}
+	// A deleted field's kept values go with it, including those on entries
+	// that no longer hold a value for the field.
+	if len(deletedIDs) > 0 {
+		batch.Queue(
+			`UPDATE log_entries SET unconverted_fields = unconverted_fields - $2::text[]
+			 WHERE log_id = $1 AND unconverted_fields ?| $2::text[]`,
+			logID, deletedIDs,
+		)
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+var errLogFieldsChanged = errors.New("log fields changed, please retry")
+
+// lockLogFields takes a share lock on logID's row for the rest of tx, which
+// keeps a log update from migrating entries while entry values are written,
+// and checks that the log still has the fields the values were validated
+// against. It returns errLogFieldsChanged if the fields changed in between,
+// and pgx.ErrNoRows if the log was deleted.
+func lockLogFields(ctx context.Context, tx pgx.Tx, logID string, fields []fieldDefinition) error {
+	var current []fieldDefinition
+	err := tx.QueryRow(ctx, `SELECT fields FROM logs WHERE id = $1 FOR SHARE`, logID).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(current, fields) {
+		return errLogFieldsChanged
+	}
+	return nil
+}
+
+// convertFieldValue converts a value stored for the field from to the value
+// stored for the field to, which has a different type. The value is rendered
+// as text and parsed the way a CSV import cell would be, so for example the
+// text "1h20m" becomes a duration of 4800 seconds and a select value becomes
+// its option's label as text. It returns nil if the value is blank.
+func convertFieldValue(from, to fieldDefinition, v any) (any, error) {
+	parsed, err := parseImportFieldValue(to, fieldValueText(from, v), time.UTC)
+	if err != nil || parsed == nil {
+		return nil, err
+	}
+
+	to.Required = false
+	to.Archived = false
+	values := map[string]any{to.Name: parsed}
+	if err := validateFieldValues([]fieldDefinition{to}, values); err != nil {
+		return nil, err
+	}
+	return values[to.Name], nil
+}
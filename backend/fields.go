@@ -0,0 +1,412 @@
+package backend
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxSelectOptions = 100
+
+// selectOption is one choice of a select or multiselect field. Entries store
+// the option's ID rather than its label, so an option can be renamed without
+// touching existing entries. A retired option stays valid on the entries that
+// already use it but cannot be chosen for new values.
+type selectOption struct {
+	ID      string `json:"id"`
+	Label   string `json:"label"`
+	Retired bool   `json:"retired,omitempty"`
+}
+
+// validateSelectOptions checks the options of the select or multiselect field
+// name. Labels are trimmed and options without an ID are assigned a new one.
+func validateSelectOptions(name string, options []selectOption) error {
+	if len(options) == 0 {
+		return fmt.Errorf("field %q must have at least one option", name)
+	}
+	if len(options) > maxSelectOptions {
+		return fmt.Errorf("field %q has too many options (max %d)", name, maxSelectOptions)
+	}
+
+	ids := make(map[string]bool)
+	labels := make(map[string]bool)
+	for i := range options {
+		o := &options[i]
+		o.Label = strings.TrimSpace(o.Label)
+		if o.Label == "" || len(o.Label) > 100 {
+			return fmt.Errorf("field %q: option labels must be 1-100 characters", name)
+		}
+		lower := strings.ToLower(o.Label)
+		if labels[lower] {
+			return fmt.Errorf("field %q: duplicate option label: %s", name, o.Label)
+		}
+		labels[lower] = true
+
+		if len(o.ID) > 36 {
+			return fmt.Errorf("field %q: option ids must be at most 36 characters", name)
+		}
+		if o.ID != "" {
+			if ids[o.ID] {
+				return fmt.Errorf("field %q: duplicate option id: %s", name, o.ID)
+			}
+			ids[o.ID] = true
+		}
+	}
+
+	for i := range options {
+		for options[i].ID == "" {
+			if id := newShortID(); !ids[id] {
+				options[i].ID = id
+				ids[id] = true
+			}
+		}
+	}
+	return nil
+}
+
+// newShortID returns a random ID for a field or option. It only needs to be
+// unique within its log, so it is much shorter than a UUID.
+func newShortID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func findSelectOption(options []selectOption, id string) *selectOption {
+	for i := range options {
+		if options[i].ID == id {
+			return &options[i]
+		}
+	}
+	return nil
+}
+
+// findSelectOptionByLabel finds an option by ID or, failing that, by its label
+// ignoring case.
+func findSelectOptionByLabel(options []selectOption, s string) *selectOption {
+	if o := findSelectOption(options, s); o != nil {
+		return o
+	}
+	for i := range options {
+		if strings.EqualFold(options[i].Label, strings.TrimSpace(s)) {
+			return &options[i]
+		}
+	}
+	return nil
+}
+
+// assignFieldIDs gives fields in next that were sent without an ID the ID of
+// the field in previous with the same name, so clients that only know field
+// names keep the existing IDs. Fields that still have no ID are new and are
+// assigned one by validateFieldDefinitions.
+func assignFieldIDs(previous, next []fieldDefinition) {
+	used := make(map[string]bool)
+	for _, d := range next {
+		used[d.ID] = true
+	}
+	for i := range next {
+		if next[i].ID != "" {
+			continue
+		}
+		for _, d := range previous {
+			if d.ID != "" && !used[d.ID] && strings.EqualFold(d.Name, strings.TrimSpace(next[i].Name)) {
+				next[i].ID = d.ID
+				used[d.ID] = true
+				break
+			}
+		}
+	}
+}
+
+// reconcileSelectOptions prepares the new field definitions of a log whose
+// current definitions are previous. Fields are matched by ID, so
+// assignFieldIDs must be called first. Options sent without an ID are matched
+// to an existing option with the same label so clients that only know labels
+// keep the existing IDs. It returns an error if an option of a select or
+// multiselect field would be removed, since existing entries would then hold
+// an unknown value. Options should be retired instead.
+func reconcileSelectOptions(previous, next []fieldDefinition) error {
+	prevByID := make(map[string]fieldDefinition)
+	for _, d := range previous {
+		if hasOptions(d.Type) {
+			prevByID[d.ID] = d
+		}
+	}
+
+	for i := range next {
+		if !hasOptions(next[i].Type) {
+			continue
+		}
+		prev, ok := prevByID[next[i].ID]
+		if !ok || next[i].ID == "" || prev.Type != next[i].Type {
+			continue
+		}
+
+		for j := range next[i].Options {
+			o := &next[i].Options[j]
+			if o.ID != "" {
+				continue
+			}
+			for _, po := range prev.Options {
+				if strings.EqualFold(po.Label, strings.TrimSpace(o.Label)) {
+					o.ID = po.ID
+					break
+				}
+			}
+		}
+
+		for _, po := range prev.Options {
+			if findSelectOption(next[i].Options, po.ID) == nil {
+				return fmt.Errorf("option %q of field %q cannot be removed; retire it instead", po.Label, prev.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func hasOptions(fieldType string) bool {
+	return fieldType == "select" || fieldType == "multiselect"
+}
+
+// normalizeMultiselectValue converts the value v of the multiselect field def
+// to the list of chosen option IDs in the field's option order. Duplicates are
+// ignored. A retired option is only accepted if it is in previous, the
+// field's current value on the entry being updated.
+func normalizeMultiselectValue(def fieldDefinition, v, previous any) ([]string, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("field %q must be an array of option ids", def.Name)
+	}
+
+	kept := make(map[string]bool)
+	if prevItems, ok := previous.([]any); ok {
+		for _, item := range prevItems {
+			if s, ok := item.(string); ok {
+				kept[s] = true
+			}
+		}
+	}
+
+	chosen := make(map[string]bool, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("field %q must be an array of option ids", def.Name)
+		}
+		opt := findSelectOption(def.Options, s)
+		if opt == nil {
+			return nil, fmt.Errorf("field %q values must be among its options", def.Name)
+		}
+		if opt.Retired && !kept[s] {
+			return nil, fmt.Errorf("option %q of field %q is retired", opt.Label, def.Name)
+		}
+		chosen[s] = true
+	}
+
+	ids := make([]string, 0, len(chosen))
+	for _, o := range def.Options {
+		if chosen[o.ID] {
+			ids = append(ids, o.ID)
+		}
+	}
+	return ids, nil
+}
+
+// parseOptionList resolves a comma separated list of option IDs or labels of
+// def to option IDs.
+func parseOptionList(def fieldDefinition, s string) ([]string, error) {
+	var ids []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		opt := findSelectOptionByLabel(def.Options, part)
+		if opt == nil {
+			return nil, fmt.Errorf("field %q has no option %q", def.Name, part)
+		}
+		ids = append(ids, opt.ID)
+	}
+	return ids, nil
+}
+
+var isoDurationRegexp = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)W)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseDuration parses a duration given as an ISO 8601 duration such as
+// "PT1H20M", a Go style duration such as "1h20m", or a plain number of
+// seconds, and returns it in seconds. ISO 8601 years and months are rejected
+// because their length varies, and a day is taken to be 24 hours.
+func parseDuration(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	var secs float64
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		secs = n
+	} else if strings.HasPrefix(strings.ToUpper(s), "P") {
+		upper := strings.ToUpper(s)
+		m := isoDurationRegexp.FindStringSubmatch(upper)
+		// The pattern also matches "P" and "PT", which have no components.
+		if m == nil || upper == "P" || strings.HasSuffix(upper, "T") {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		units := []float64{7 * 24 * 3600, 24 * 3600, 3600, 60, 1}
+		for i, unit := range units {
+			if m[i+1] != "" {
+				n, _ := strconv.ParseFloat(m[i+1], 64)
+				secs += n * unit
+			}
+		}
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		secs = d.Seconds()
+	}
+
+	if secs < 0 || math.IsInf(secs, 0) || math.IsNaN(secs) {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return secs, nil
+}
+
+// formatDuration renders seconds compactly, such as "1h20m" or "45.5s".
+func formatDuration(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	str := d.String()
+	if strings.HasSuffix(str, "m0s") {
+		str = strings.TrimSuffix(str, "0s")
+	}
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
+
+// formatEntryFields returns human readable renderings of the field values that
+// are not shown as stored, such as durations held as seconds. It returns nil
+// when there are none.
+func formatEntryFields(definitions []fieldDefinition, fields map[string]any) map[string]string {
+	var formatted map[string]string
+	for _, def := range definitions {
+		if def.Type != "duration" {
+			continue
+		}
+		secs, ok := fields[def.Name].(float64)
+		if !ok {
+			continue
+		}
+		if formatted == nil {
+			formatted = make(map[string]string)
+		}
+		formatted[def.Name] = formatDuration(secs)
+	}
+	return formatted
+}
+
+// parseDatetimeValue parses the value of a datetime field. The value must be
+// an RFC 3339 timestamp with a time zone offset so that it names an instant.
+func parseDatetimeValue(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+}
+
+// formatDatetimeValue renders t as stored in a datetime field: RFC 3339 in
+// UTC.
+func formatDatetimeValue(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// validateNumberConstraints checks the min, max, step, integer and unit
+// settings of the number field def and trims its unit.
+func validateNumberConstraints(def *fieldDefinition) error {
+	def.Unit = strings.TrimSpace(def.Unit)
+	if len(def.Unit) > 20 {
+		return fmt.Errorf("field %q: unit must be at most 20 characters", def.Name)
+	}
+	for _, v := range []*float64{def.Min, def.Max, def.Step} {
+		if v != nil && (math.IsInf(*v, 0) || math.IsNaN(*v)) {
+			return fmt.Errorf("field %q: min, max and step must be finite", def.Name)
+		}
+	}
+	if def.Min != nil && def.Max != nil && *def.Min > *def.Max {
+		return fmt.Errorf("field %q: min must not be greater than max", def.Name)
+	}
+	if def.Step != nil && *def.Step <= 0 {
+		return fmt.Errorf("field %q: step must be greater than zero", def.Name)
+	}
+	return nil
+}
+
+// checkNumberConstraints reports whether n satisfies the constraints of the
+// number field def.
+func checkNumberConstraints(def fieldDefinition, n float64) error {
+	if def.Integer && n != math.Trunc(n) {
+		return fmt.Errorf("field %q must be a whole number", def.Name)
+	}
+	if def.Min != nil && n < *def.Min {
+		return fmt.Errorf("field %q must be at least %s", def.Name, formatNumber(*def.Min))
+	}
+	if def.Max != nil && n > *def.Max {
+		return fmt.Errorf("field %q must be at most %s", def.Name, formatNumber(*def.Max))
+	}
+	if def.Step != nil {
+		var base float64
+		if def.Min != nil {
+			base = *def.Min
+		}
+		// Allow for binary floating point error in steps such as 0.1.
+		steps := (n - base) / *def.Step
+		if math.Abs(steps-math.Round(steps)) > 1e-9 {
+			return fmt.Errorf("field %q must be in steps of %s", def.Name, formatNumber(*def.Step))
+		}
+	}
+	return nil
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// fieldValueText renders a stored field value of def as plain text. Select
+// values are written as their option label and multiselect values as a comma
+// separated list of labels. Missing values are empty.
+func fieldValueText(def fieldDefinition, v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case []any:
+		labels := make([]string, 0, len(v))
+		for _, item := range v {
+			s := fmt.Sprint(item)
+			if opt := findSelectOption(def.Options, s); opt != nil {
+				s = opt.Label
+			}
+			labels = append(labels, s)
+		}
+		return strings.Join(labels, ", ")
+	case string:
+		if def.Type == "select" {
+			if opt := findSelectOption(def.Options, v); opt != nil {
+				return opt.Label
+			}
+		}
+		return v
+	case float64:
+		return formatNumber(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
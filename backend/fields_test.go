@@ -0,0 +1,356 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFieldDefinitions_Select(t *testing.T) {
+	fields := []fieldDefinition{
+		{Name: "mood", Type: "select", Options: []selectOption{
+			{ID: "good", Label: " Good "},
+			{Label: "Bad"},
+		}},
+	}
+	require.NoError(t, validateFieldDefinitions(fields))
+
+	opts := fields[0].Options
+	assert.Equal(t, "good", opts[0].ID)
+	assert.Equal(t, "Good", opts[0].Label)
+	assert.Len(t, opts[1].ID, 8)
+	assert.NotEqual(t, "good", opts[1].ID)
+}
+
+func TestValidateFieldDefinitions_SelectErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   fieldDefinition
+		wantErr string
+	}{
+		{"no options", fieldDefinition{Name: "mood", Type: "select"}, "at least one option"},
+		{"blank label", fieldDefinition{Name: "mood", Type: "select", Options: []selectOption{{Label: " "}}}, "option labels"},
+		{"duplicate label", fieldDefinition{Name: "mood", Type: "select", Options: []selectOption{{Label: "Good"}, {Label: "good"}}}, "duplicate option label"},
+		{"duplicate id", fieldDefinition{Name: "mood", Type: "select", Options: []selectOption{{ID: "a", Label: "Good"}, {ID: "a", Label: "Bad"}}}, "duplicate option id"},
+		{"options on text", fieldDefinition{Name: "notes", Type: "text", Options: []selectOption{{Label: "Good"}}}, "only allowed on select"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFieldDefinitions([]fieldDefinition{tt.field})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateFieldValues_Select(t *testing.T) {
+	defs := []fieldDefinition{
+		{Name: "mood", Type: "select", Required: true, Options: []selectOption{
+			{ID: "good", Label: "Good"},
+			{ID: "meh", Label: "Meh", Retired: true},
+		}},
+	}
+
+	assert.NoError(t, validateFieldValues(defs, map[string]any{"mood": "good"}))
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"mood": "Good"}), "must be one of its options")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"mood": ""}), "is required")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"mood": 1.0}), "must be an option id")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"mood": "meh"}), "retired")
+
+	// An entry that already holds a retired option may keep it.
+	assert.NoError(t, validateUpdatedFieldValues(defs, map[string]any{"mood": "meh"}, map[string]any{"mood": "meh"}))
+	assert.ErrorContains(t, validateUpdatedFieldValues(defs, map[string]any{"mood": "meh"}, map[string]any{"mood": "good"}), "retired")
+}
+
+func TestReconcileSelectOptions(t *testing.T) {
+	previous := []fieldDefinition{
+		{ID: "f1", Name: "mood", Type: "select", Options: []selectOption{
+			{ID: "a1", Label: "Good"},
+			{ID: "b2", Label: "Bad"},
+		}},
+	}
+
+	// Options without IDs are matched by label.
+	next := []fieldDefinition{
+		{ID: "f1", Name: "mood", Type: "select", Options: []selectOption{
+			{Label: "good"},
+			{ID: "b2", Label: "Awful"},
+			{Label: "Great"},
+		}},
+	}
+	require.NoError(t, reconcileSelectOptions(previous, next))
+	assert.Equal(t, "a1", next[0].Options[0].ID)
+	assert.Equal(t, "b2", next[0].Options[1].ID)
+	assert.Equal(t, "", next[0].Options[2].ID)
+
+	// Removing an option is rejected.
+	next = []fieldDefinition{
+		{ID: "f1", Name: "mood", Type: "select", Options: []selectOption{{ID: "a1", Label: "Good"}}},
+	}
+	assert.ErrorContains(t, reconcileSelectOptions(previous, next), "retire it instead")
+}
+
+func TestValidateFieldValues_Multiselect(t *testing.T) {
+	defs := []fieldDefinition{
+		{Name: "tags", Type: "multiselect", Required: true, Options: []selectOption{
+			{ID: "a", Label: "Morning"},
+			{ID: "b", Label: "Outdoors"},
+			{ID: "c", Label: "Gym", Retired: true},
+		}},
+	}
+
+	// Values are stored deduplicated in option order.
+	values := map[string]any{"tags": []any{"b", "a", "b"}}
+	require.NoError(t, validateFieldValues(defs, values))
+	assert.Equal(t, []string{"a", "b"}, values["tags"])
+
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"tags": []any{}}), "is required")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"tags": "a"}), "array of option ids")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"tags": []any{"x"}}), "among its options")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"tags": []any{"c"}}), "retired")
+
+	// A retired option already on the entry may be kept.
+	previous := map[string]any{"tags": []any{"c"}}
+	assert.NoError(t, validateUpdatedFieldValues(defs, map[string]any{"tags": []any{"a", "c"}}, previous))
+}
+
+func TestValidateFieldDefinitions_MultiselectLabelWithComma(t *testing.T) {
+	err := validateFieldDefinitions([]fieldDefinition{
+		{Name: "tags", Type: "multiselect", Options: []selectOption{{Label: "Rain, heavy"}}},
+	})
+	assert.ErrorContains(t, err, "must not contain commas")
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"PT1H20M", 4800},
+		{"pt45s", 45},
+		{"P1DT2H", 26 * 3600},
+		{"P1W", 7 * 24 * 3600},
+		{"PT1.5M", 90},
+		{"1h20m", 4800},
+		{"90s", 90},
+		{"1.5h", 5400},
+		{"300", 300},
+		{" 2m ", 120},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, in := range []string{"", "P", "PT", "P1Y", "P1M", "-5m", "-1", "soon", "1 hour"} {
+		_, err := parseDuration(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "1h20m", formatDuration(4800))
+	assert.Equal(t, "1h", formatDuration(3600))
+	assert.Equal(t, "1h0m5s", formatDuration(3605))
+	assert.Equal(t, "1m30.5s", formatDuration(90.5))
+	assert.Equal(t, "0s", formatDuration(0))
+}
+
+func TestValidateFieldValues_Duration(t *testing.T) {
+	defs := []fieldDefinition{
+		{Name: "time", Type: "duration", Required: true},
+		{Name: "rest", Type: "duration"},
+	}
+
+	values := map[string]any{"time": "PT1H20M", "rest": ""}
+	require.NoError(t, validateFieldValues(defs, values))
+	assert.Equal(t, map[string]any{"time": 4800.0}, values)
+
+	values = map[string]any{"time": 90.0}
+	require.NoError(t, validateFieldValues(defs, values))
+	assert.Equal(t, 90.0, values["time"])
+
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"time": "soon"}), "must be a duration")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"time": -1.0}), "must not be negative")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"time": ""}), "is required")
+
+	assert.Equal(t, map[string]string{"time": "1h20m"}, formatEntryFields(defs, map[string]any{"time": 4800.0}))
+	assert.Nil(t, formatEntryFields(defs, map[string]any{}))
+}
+
+func TestValidateFieldValues_DateAndDatetime(t *testing.T) {
+	defs := []fieldDefinition{
+		{Name: "due", Type: "date"},
+		{Name: "started_at", Type: "datetime"},
+	}
+
+	values := map[string]any{"due": "2025-06-15", "started_at": "2025-06-15T08:30:00-05:00"}
+	require.NoError(t, validateFieldValues(defs, values))
+	assert.Equal(t, "2025-06-15", values["due"])
+	assert.Equal(t, "2025-06-15T13:30:00Z", values["started_at"])
+
+	for _, bad := range []string{"2025-6-15", "2025-02-30", "06/15/2025", "2025-06-15T08:30:00Z"} {
+		assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"due": bad}), "YYYY-MM-DD", bad)
+	}
+	for _, bad := range []string{"2025-06-15", "2025-06-15T08:30:00", "2025-06-15 08:30:00Z"} {
+		assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"started_at": bad}), "time zone offset", bad)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestValidateFieldDefinitions_NumberConstraints(t *testing.T) {
+	fields := []fieldDefinition{
+		{Name: "weight", Type: "number", Min: ptr(0.0), Max: ptr(500.0), Step: ptr(0.1), Unit: " kg "},
+	}
+	require.NoError(t, validateFieldDefinitions(fields))
+	assert.Equal(t, "kg", fields[0].Unit)
+
+	tests := []struct {
+		field   fieldDefinition
+		wantErr string
+	}{
+		{fieldDefinition{Name: "n", Type: "number", Min: ptr(10.0), Max: ptr(1.0)}, "min must not be greater than max"},
+		{fieldDefinition{Name: "n", Type: "number", Step: ptr(0.0)}, "step must be greater than zero"},
+		{fieldDefinition{Name: "n", Type: "number", Unit: "a very long unit label indeed"}, "at most 20 characters"},
+		{fieldDefinition{Name: "n", Type: "text", Unit: "kg"}, "only allowed on number fields"},
+		{fieldDefinition{Name: "n", Type: "boolean", Integer: true}, "only allowed on number fields"},
+	}
+	for _, tt := range tests {
+		err := validateFieldDefinitions([]fieldDefinition{tt.field})
+		assert.ErrorContains(t, err, tt.wantErr)
+	}
+}
+
+func TestValidateFieldValues_NumberConstraints(t *testing.T) {
+	defs := []fieldDefinition{
+		{Name: "weight", Type: "number", Min: ptr(0.0), Max: ptr(500.0), Step: ptr(0.1)},
+		{Name: "reps", Type: "number", Integer: true},
+		{Name: "pace", Type: "number", Min: ptr(1.0), Step: ptr(0.25)},
+	}
+
+	assert.NoError(t, validateFieldValues(defs, map[string]any{"weight": "72.3", "reps": "12", "pace": "1.75"}))
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"weight": "-1"}), "at least 0")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"weight": "500.1"}), "at most 500")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"weight": "72.35"}), "steps of 0.1")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"reps": "12.5"}), "whole number")
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"pace": "1.3"}), "steps of 0.25")
+}
+
+func TestAssignFieldIDs(t *testing.T) {
+	previous := []fieldDefinition{
+		{ID: "f1", Name: "count", Type: "number"},
+		{ID: "f2", Name: "notes", Type: "text"},
+	}
+	next := []fieldDefinition{
+		{Name: "Notes", Type: "text"},
+		{ID: "f1", Name: "reps", Type: "number"},
+		{Name: "count", Type: "number"},
+	}
+	assignFieldIDs(previous, next)
+	assert.Equal(t, "f2", next[0].ID)
+	assert.Equal(t, "f1", next[1].ID)
+	// f1 is already taken by the renamed field.
+	assert.Equal(t, "", next[2].ID)
+}
+
+func TestPlanFieldMigration(t *testing.T) {
+	previous := []fieldDefinition{
+		{ID: "f1", Name: "count", Type: "number"},
+		{ID: "f2", Name: "notes", Type: "text"},
+		{ID: "f3", Name: "time", Type: "text"},
+		{ID: "f4", Name: "done", Type: "boolean"},
+	}
+	next := []fieldDefinition{
+		{ID: "f1", Name: "reps", Type: "number"},
+		{ID: "f3", Name: "time", Type: "duration"},
+		{ID: "f4", Name: "done", Type: "boolean", Required: true},
+		{ID: "f5", Name: "mood", Type: "text"},
+	}
+
+	changes := planFieldMigration(previous, next)
+	require.Len(t, changes, 3)
+	assert.Equal(t, "f1", changes[0].FieldID)
+	assert.Equal(t, "reps", changes[0].NewName)
+	assert.Equal(t, "", changes[0].NewType)
+	assert.Equal(t, "f2", changes[1].FieldID)
+	assert.True(t, changes[1].Deleted)
+	assert.Equal(t, "f3", changes[2].FieldID)
+	assert.Equal(t, "", changes[2].NewName)
+	assert.Equal(t, "duration", changes[2].NewType)
+}
+
+func TestConvertFieldValue(t *testing.T) {
+	text := fieldDefinition{Name: "v", Type: "text"}
+	mood := fieldDefinition{Name: "v", Type: "select", Options: []selectOption{{ID: "a1", Label: "Good"}}}
+
+	tests := []struct {
+		from, to fieldDefinition
+		in       any
+		want     any
+	}{
+		{text, fieldDefinition{Name: "v", Type: "number"}, "42.5", "42.5"},
+		{text, fieldDefinition{Name: "v", Type: "duration"}, "1h20m", 4800.0},
+		{text, fieldDefinition{Name: "v", Type: "boolean"}, "yes", true},
+		{fieldDefinition{Name: "v", Type: "number"}, text, "3", "3"},
+		{mood, text, "a1", "Good"},
+		{text, mood, "good", "a1"},
+		{text, fieldDefinition{Name: "v", Type: "number"}, " ", nil},
+		{fieldDefinition{Name: "v", Type: "duration"}, text, 1209600.0, "1209600"},
+		{fieldDefinition{Name: "v", Type: "duration"}, fieldDefinition{Name: "v", Type: "number"}, 0.5, "0.5"},
+	}
+	for _, tt := range tests {
+		got, err := convertFieldValue(tt.from, tt.to, tt.in)
+		require.NoError(t, err, "%v to %s", tt.in, tt.to.Type)
+		assert.Equal(t, tt.want, got, "%v to %s", tt.in, tt.to.Type)
+	}
+
+	_, err := convertFieldValue(text, fieldDefinition{Name: "v", Type: "number"}, "lots")
+	assert.Error(t, err)
+	_, err = convertFieldValue(text, fieldDefinition{Name: "v", Type: "number", Integer: true}, "1.5")
+	assert.Error(t, err)
+}
+
+func TestValidateFieldDefinitions_DisplaySettings(t *testing.T) {
+	fields := []fieldDefinition{
+		{Name: "notes", Type: "text", Order: 2, Description: " Anything else ", Placeholder: " e.g. felt tired "},
+		{Name: "dose", Type: "text", Order: 1},
+		{Name: "time", Type: "duration", Order: 2},
+		{Name: "brand", Type: "text"},
+	}
+	require.NoError(t, validateFieldDefinitions(fields))
+
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	assert.Equal(t, []string{"brand", "dose", "notes", "time"}, names)
+	assert.Equal(t, "Anything else", fields[2].Description)
+	assert.Equal(t, "e.g. felt tired", fields[2].Placeholder)
+
+	err := validateFieldDefinitions([]fieldDefinition{{Name: "n", Type: "text", Placeholder: strings.Repeat("x", 101)}})
+	assert.ErrorContains(t, err, "placeholder must be at most 100 characters")
+	err = validateFieldDefinitions([]fieldDefinition{{Name: "n", Type: "text", Description: strings.Repeat("x", 501)}})
+	assert.ErrorContains(t, err, "description must be at most 500 characters")
+}
+
+func TestValidateFieldValues_Archived(t *testing.T) {
+	defs := []fieldDefinition{
+		{Name: "dose", Type: "text", Required: true, Archived: true},
+		{Name: "count", Type: "number"},
+	}
+
+	// New entries may neither need nor set an archived field.
+	assert.NoError(t, validateFieldValues(defs, map[string]any{"count": "1"}))
+	assert.ErrorContains(t, validateFieldValues(defs, map[string]any{"dose": "500mg"}), "is archived")
+
+	// Entries that already have a value can still be edited.
+	previous := map[string]any{"dose": "500mg"}
+	assert.NoError(t, validateUpdatedFieldValues(defs, map[string]any{"dose": "250mg"}, previous))
+	assert.NoError(t, validateUpdatedFieldValues(defs, map[string]any{"dose": ""}, previous))
+}
@@ -0,0 +1,303 @@
+package backend
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entryQuery accumulates SQL conditions and their positional arguments for
+// queries over log_entries (aliased le) joined to users (aliased u).
+type entryQuery struct {
+	conditions []string
+	args       []any
+}
+
+func newEntryQuery(logID string) *entryQuery {
+	q := &entryQuery{}
+	q.where("le.log_id = " + q.arg(logID))
+	return q
+}
+
+// arg adds v to the argument list and returns its placeholder.
+func (q *entryQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *entryQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// clone returns a copy of q that further conditions can be added to without
+// affecting q.
+func (q *entryQuery) clone() *entryQuery {
+	return &entryQuery{conditions: slices.Clone(q.conditions), args: slices.Clone(q.args)}
+}
+
+func (q *entryQuery) whereSQL() string {
+	return strings.Join(q.conditions, " AND ")
+}
+
+// applyEntryFilters adds the filters given in the query string to q.
+//
+// Supported parameters:
+//
+//	from, to  occurred_at range. from is inclusive and to is exclusive. Each is
+//	          an RFC 3339 timestamp or a YYYY-MM-DD date. A date is interpreted
+//	          in tz, and a date given for to includes that whole day.
+//	tz        IANA time zone for date values (default UTC)
+//	user_id   only entries submitted by this user
+//	username  only entries submitted by this user (case insensitive)
+//
+// Custom field predicates take the form field.<name>.<op>=<value> and are
+// validated against fields. See applyFieldFilter for the supported operators.
+func applyEntryFilters(q *entryQuery, values url.Values, fields []fieldDefinition) error {
+	loc, err := loadTimeZone(values.Get("tz"))
+	if err != nil {
+		return err
+	}
+
+	if s := values.Get("from"); s != "" {
+		from, err := parseFilterTime(s, loc, false)
+		if err != nil {
+			return fmt.Errorf("from must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		q.where("le.occurred_at >= " + q.arg(from))
+	}
+
+	if s := values.Get("to"); s != "" {
+		to, err := parseFilterTime(s, loc, true)
+		if err != nil {
+			return fmt.Errorf("to must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		q.where("le.occurred_at < " + q.arg(to))
+	}
+
+	if s := values.Get("user_id"); s != "" {
+		// Compare as text so a malformed id matches nothing instead of failing the uuid cast.
+		q.where("le.user_id::text = " + q.arg(strings.ToLower(s)))
+	}
+
+	if s := values.Get("username"); s != "" {
+		q.where("lower(coalesce(u.username, le.deleted_username)) = lower(" + q.arg(s) + ")")
+	}
+
+	defMap := make(map[string]fieldDefinition)
+	for _, d := range fields {
+		defMap[d.Name] = d
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if strings.HasPrefix(key, fieldFilterPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		// The operator follows the last dot so field names may contain dots.
+		name, op, ok := cutLast(strings.TrimPrefix(key, fieldFilterPrefix), ".")
+		if !ok || name == "" {
+			return fmt.Errorf("field filter must be of the form field.<name>.<op>")
+		}
+		def, ok := defMap[name]
+		if !ok {
+			return fmt.Errorf("unknown field: %s", name)
+		}
+		for _, value := range values[key] {
+			if err := applyFieldFilter(q, def, op, value, loc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+const fieldFilterPrefix = "field."
+
+// applyFieldFilter adds a predicate on the custom field def to q. Supported
+// operators are:
+//
+//	text         eq, contains (case insensitive)
+//	number       eq, gt, gte, lt, lte
+//	computed     eq, gt, gte, lt, lte
+//	duration     eq, gt, gte, lt, lte (as accepted by parseDuration)
+//	boolean      eq (true or false)
+//	select       eq (option id or label)
+//	multiselect  any, all (comma separated option ids or labels)
+//
+// Date and datetime values are compared as dates and instants. A datetime
+// filter value may be a YYYY-MM-DD date in loc, in which case lte and gt
+// include or exclude the whole day.
+func applyFieldFilter(q *entryQuery, def fieldDefinition, op, value string, loc *time.Location) error {
+	key := q.arg(def.Name) + "::text"
+
+	switch def.Type {
+	case "text":
+		switch op {
+		case "eq":
+			q.where("le.fields->>" + key + " = " + q.arg(value))
+		case "contains":
+			q.where("strpos(lower(le.fields->>" + key + "), lower(" + q.arg(value) + ")) > 0")
+		default:
+			return fmt.Errorf("field %q does not support %q (use eq or contains)", def.Name, op)
+		}
+	case "number", "duration", "computed":
+		cmp, ok := comparisonOperators[op]
+		if !ok {
+			return fmt.Errorf("field %q does not support %q (use eq, gt, gte, lt or lte)", def.Name, op)
+		}
+		var n float64
+		var err error
+		if def.Type == "duration" {
+			n, err = parseDuration(value)
+			if err != nil {
+				return fmt.Errorf("field %q filter value must be a valid duration", def.Name)
+			}
+		} else {
+			n, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("field %q filter value must be a valid number", def.Name)
+			}
+		}
+		q.where(numericFieldSQL(key) + " " + cmp + " " + q.arg(n) + "::numeric")
+	case "boolean":
+		if op != "eq" {
+			return fmt.Errorf("field %q does not support %q (use eq)", def.Name, op)
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("field %q filter value must be true or false", def.Name)
+		}
+		q.where("le.fields->" + key + " = to_jsonb(" + q.arg(b) + "::boolean)")
+	case "date":
+		cmp, ok := comparisonOperators[op]
+		if !ok {
+			return fmt.Errorf("field %q does not support %q (use eq, gt, gte, lt or lte)", def.Name, op)
+		}
+		d, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return fmt.Errorf("field %q filter value must be a YYYY-MM-DD date", def.Name)
+		}
+		q.where(typedFieldSQL(key, "date") + " " + cmp + " " + q.arg(d.Format(time.DateOnly)) + "::date")
+	case "datetime":
+		cmp, ok := comparisonOperators[op]
+		if !ok || op == "eq" {
+			return fmt.Errorf("field %q does not support %q (use gt, gte, lt or lte)", def.Name, op)
+		}
+		t, err := parseFilterTime(value, loc, false)
+		if err != nil {
+			return fmt.Errorf("field %q filter value must be an RFC 3339 timestamp or YYYY-MM-DD date", def.Name)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			// A date covers the whole day, so "on or before" and "after" are
+			// measured from the following midnight.
+			switch op {
+			case "lte":
+				cmp, t = "<", t.AddDate(0, 0, 1)
+			case "gt":
+				cmp, t = ">=", t.AddDate(0, 0, 1)
+			}
+		}
+		q.where(typedFieldSQL(key, "timestamptz") + " " + cmp + " " + q.arg(t))
+	case "select":
+		if op != "eq" {
+			return fmt.Errorf("field %q does not support %q (use eq)", def.Name, op)
+		}
+		opt := findSelectOptionByLabel(def.Options, value)
+		if opt == nil {
+			return fmt.Errorf("field %q filter value must be one of its options", def.Name)
+		}
+		q.where("le.fields->>" + key + " = " + q.arg(opt.ID))
+	case "multiselect":
+		var jsonOp string
+		switch op {
+		case "any":
+			jsonOp = "?|"
+		case "all":
+			jsonOp = "?&"
+		default:
+			return fmt.Errorf("field %q does not support %q (use any or all)", def.Name, op)
+		}
+		ids, err := parseOptionList(def, value)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("field %q filter value must list at least one option", def.Name)
+		}
+		q.where("jsonb_typeof(le.fields->" + key + ") = 'array' AND le.fields->" + key + " " + jsonOp + " " + q.arg(ids) + "::text[]")
+	default:
+		return fmt.Errorf("field %q cannot be filtered", def.Name)
+	}
+	return nil
+}
+
+var comparisonOperators = map[string]string{
+	"eq":  "=",
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+// numericFieldSQL returns an expression that extracts the field named by the
+// placeholder key as numeric. Number fields are stored as strings and may be
+// blank, so values that are not valid numerics yield NULL instead of an error.
+func numericFieldSQL(key string) string {
+	return typedFieldSQL(key, "numeric")
+}
+
+// typedFieldSQL returns an expression that extracts the field named by the
+// placeholder key cast to the SQL type typ. Values that are not valid input
+// for typ, such as those written before the field's type changed, yield NULL.
+func typedFieldSQL(key, typ string) string {
+	return "(CASE WHEN pg_input_is_valid(le.fields->>" + key + ", '" + typ + "') THEN (le.fields->>" + key + ")::" + typ + " END)"
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// loadTimeZone loads the IANA time zone name. An empty name is UTC. "Local" is
+// rejected because it names the server's zone, which PostgreSQL does not
+// recognize.
+func loadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name == "Local" {
+		return nil, fmt.Errorf("invalid tz: %s", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz: %s", name)
+	}
+	return loc, nil
+}
+
+// parseFilterTime parses an RFC 3339 timestamp or a YYYY-MM-DD date in loc.
+// When endOfDay is true a date is resolved to midnight at the start of the
+// following day so it can be used as an exclusive upper bound.
+func parseFilterTime(s string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,147 @@
+package backend
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilterTime_RFC3339(t *testing.T) {
+	ts, err := parseFilterTime("2025-06-15T10:30:00-05:00", time.UTC, true)
+	require.NoError(t, err)
+	assert.True(t, ts.Equal(time.Date(2025, 6, 15, 15, 30, 0, 0, time.UTC)))
+}
+
+func TestParseFilterTime_DateInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+
+	from, err := parseFilterTime("2025-06-15", loc, false)
+	require.NoError(t, err)
+	assert.True(t, from.Equal(time.Date(2025, 6, 15, 5, 0, 0, 0, time.UTC)))
+
+	to, err := parseFilterTime("2025-06-15", loc, true)
+	require.NoError(t, err)
+	assert.True(t, to.Equal(time.Date(2025, 6, 16, 5, 0, 0, 0, time.UTC)))
+}
+
+func TestParseFilterTime_Invalid(t *testing.T) {
+	_, err := parseFilterTime("yesterday", time.UTC, false)
+	assert.Error(t, err)
+}
+
+func TestApplyEntryFilters(t *testing.T) {
+	q := newEntryQuery("log-id")
+	err := applyEntryFilters(q, url.Values{
+		"from":     {"2025-06-15"},
+		"to":       {"2025-06-16"},
+		"username": {"Bob"},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "le.log_id = $1 AND le.occurred_at >= $2 AND le.occurred_at < $3 AND lower(coalesce(u.username, le.deleted_username)) = lower($4)", q.whereSQL())
+	assert.Len(t, q.args, 4)
+}
+
+func TestApplyEntryFilters_InvalidTimeZone(t *testing.T) {
+	err := applyEntryFilters(newEntryQuery("log-id"), url.Values{"tz": {"Mars/Olympus"}}, nil)
+	assert.ErrorContains(t, err, "tz")
+	err = applyEntryFilters(newEntryQuery("log-id"), url.Values{"tz": {"Local"}}, nil)
+	assert.ErrorContains(t, err, "tz")
+}
+
+func TestApplyEntryFilters_InvalidFrom(t *testing.T) {
+	err := applyEntryFilters(newEntryQuery("log-id"), url.Values{"from": {"15/06/2025"}}, nil)
+	assert.ErrorContains(t, err, "from")
+}
+
+var filterTestFields = []fieldDefinition{
+	{Name: "count", Type: "number"},
+	{Name: "notes", Type: "text"},
+	{Name: "fasted", Type: "boolean"},
+	{Name: "avg.pace", Type: "number"},
+	{Name: "due", Type: "date"},
+	{Name: "started_at", Type: "datetime"},
+	{Name: "tags", Type: "multiselect", Options: []selectOption{
+		{ID: "t1", Label: "Morning"},
+		{ID: "t2", Label: "Outdoors"},
+	}},
+}
+
+func TestApplyEntryFilters_FieldPredicates(t *testing.T) {
+	q := newEntryQuery("log-id")
+	err := applyEntryFilters(q, url.Values{
+		"field.count.gte":      {"10"},
+		"field.notes.contains": {"Rash"},
+		"field.fasted.eq":      {"true"},
+		"field.avg.pace.lt":    {"5.5"},
+	}, filterTestFields)
+	require.NoError(t, err)
+	assert.Len(t, q.conditions, 5)
+	assert.Contains(t, q.args, "avg.pace")
+	assert.Contains(t, q.args, 5.5)
+	assert.Contains(t, q.args, true)
+}
+
+func TestApplyEntryFilters_FieldPredicateErrors(t *testing.T) {
+	tests := []struct {
+		values url.Values
+		errMsg string
+	}{
+		{url.Values{"field.missing.eq": {"x"}}, "unknown field"},
+		{url.Values{"field.count": {"10"}}, "field.<name>.<op>"},
+		{url.Values{"field.count.contains": {"1"}}, "does not support"},
+		{url.Values{"field.count.gt": {"ten"}}, "valid number"},
+		{url.Values{"field.notes.gt": {"a"}}, "does not support"},
+		{url.Values{"field.fasted.eq": {"maybe"}}, "true or false"},
+		{url.Values{"field.fasted.gt": {"true"}}, "does not support"},
+	}
+	for _, tt := range tests {
+		err := applyEntryFilters(newEntryQuery("log-id"), tt.values, filterTestFields)
+		assert.ErrorContains(t, err, tt.errMsg, "%v", tt.values)
+	}
+}
+
+func TestApplyEntryFilters_Multiselect(t *testing.T) {
+	q := newEntryQuery("log-id")
+	err := applyEntryFilters(q, url.Values{"field.tags.all": {"morning, t2"}}, filterTestFields)
+	require.NoError(t, err)
+	assert.Len(t, q.conditions, 2)
+	assert.Contains(t, q.conditions[1], "?&")
+	assert.Contains(t, q.args, []string{"t1", "t2"})
+
+	q = newEntryQuery("log-id")
+	err = applyEntryFilters(q, url.Values{"field.tags.any": {"Outdoors"}}, filterTestFields)
+	require.NoError(t, err)
+	assert.Contains(t, q.conditions[1], "?|")
+
+	err = applyEntryFilters(newEntryQuery("log-id"), url.Values{"field.tags.any": {"Evening"}}, filterTestFields)
+	assert.ErrorContains(t, err, "has no option")
+
+	err = applyEntryFilters(newEntryQuery("log-id"), url.Values{"field.tags.eq": {"t1"}}, filterTestFields)
+	assert.ErrorContains(t, err, "does not support")
+}
+
+func TestApplyEntryFilters_DateAndDatetime(t *testing.T) {
+	q := newEntryQuery("log-id")
+	err := applyEntryFilters(q, url.Values{
+		"field.due.gte":        {"2025-06-01"},
+		"field.started_at.lte": {"2025-06-15"},
+		"tz":                   {"America/Chicago"},
+	}, filterTestFields)
+	require.NoError(t, err)
+	require.Len(t, q.conditions, 3)
+	assert.Contains(t, q.args, "2025-06-01")
+	// A date given for lte covers the whole day in tz.
+	assert.Contains(t, q.conditions[2], " < ")
+	to := q.args[len(q.args)-1].(time.Time)
+	assert.True(t, to.Equal(time.Date(2025, 6, 16, 5, 0, 0, 0, time.UTC)))
+
+	err = applyEntryFilters(newEntryQuery("log-id"), url.Values{"field.due.eq": {"June 1"}}, filterTestFields)
+	assert.ErrorContains(t, err, "YYYY-MM-DD")
+
+	err = applyEntryFilters(newEntryQuery("log-id"), url.Values{"field.started_at.eq": {"2025-06-01"}}, filterTestFields)
+	assert.ErrorContains(t, err, "does not support")
+}
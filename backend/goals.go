@@ -0,0 +1,466 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// logGoal is a target a log's entries should reach in every period, such as
+// at least 1 entry per day, or a sum of 100 reps per day when FieldID names a
+// number, duration or computed field.
+type logGoal struct {
+	Period  string  `json:"period"`
+	Target  float64 `json:"target"`
+	FieldID string  `json:"field_id,omitempty"`
+	// TZ is the IANA time zone that period boundaries are in. Every member of
+	// a shared log sees the same periods.
+	TZ string `json:"tz"`
+}
+
+// goalStatus is the progress of a log towards its goal.
+type goalStatus struct {
+	// PeriodStart is the start of the current period in the goal's time zone.
+	PeriodStart time.Time `json:"period_start"`
+	Progress    float64   `json:"progress"`
+	Met         bool      `json:"met"`
+	// CurrentStreak counts the consecutive periods the goal was met, ending
+	// with the current period, or with the previous one while the current
+	// period's goal is not met yet.
+	CurrentStreak int `json:"current_streak"`
+	LongestStreak int `json:"longest_streak"`
+}
+
+type goalResponse struct {
+	Goal       *logGoal    `json:"goal"`
+	GoalStatus *goalStatus `json:"goal_status"`
+}
+
+// validateGoal checks goal against the fields of its log and defaults its time
+// zone to UTC.
+func validateGoal(goal *logGoal, fields []fieldDefinition) error {
+	switch goal.Period {
+	case "day", "week", "month":
+	default:
+		return fmt.Errorf("period must be day, week or month")
+	}
+	if goal.Target <= 0 {
+		return fmt.Errorf("target must be greater than zero")
+	}
+	if goal.FieldID != "" && goalField(goal, fields) == nil {
+		return fmt.Errorf("field_id must be a number, duration or computed field of the log")
+	}
+	if goal.TZ == "" {
+		goal.TZ = "UTC"
+	}
+	if _, err := loadTimeZone(goal.TZ); err != nil {
+		return err
+	}
+	return nil
+}
+
+// goalField returns the field whose values goal sums, or nil if goal counts
+// entries or its field is no longer a number, duration or computed field of
+// the log.
+func goalField(goal *logGoal, fields []fieldDefinition) *fieldDefinition {
+	if goal.FieldID == "" {
+		return nil
+	}
+	for i, f := range fields {
+		if f.ID == goal.FieldID && (f.Type == "number" || f.Type == "duration" || f.Type == "computed") {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// periodTotal is the amount a log's entries contributed to its goal in the
+// period starting at Start. Start is a wall clock time in the goal's time
+// zone, held in UTC.
+type periodTotal struct {
+	Start time.Time
+	Total float64
+}
+
+// truncatePeriod returns the start of the day, week or month containing the
+// wall clock time of t, held in UTC. Weeks start on Monday, as with
+// date_trunc.
+func truncatePeriod(t time.Time, period string) time.Time {
+	y, m, d := t.Date()
+	switch period {
+	case "week":
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, time.UTC)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// addPeriods moves the period start t forward by n periods, or back when n is
+// negative.
+func addPeriods(t time.Time, period string, n int) time.Time {
+	switch period {
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// goalStreak is the state of a goal's streaks over the periods before
+// Through, a period start held like periodTotal.Start, so the goal's status
+// can be computed from the totals of Through and later periods alone. The
+// zero value covers no periods.
+type goalStreak struct {
+	Through time.Time
+	Longest int
+	// Run counts the consecutive periods the goal was met, ending with the
+	// period before Through.
+	Run int
+}
+
+// summarizeGoal computes the status of goal from streak and the totals of the
+// periods from streak.Through on, sorted by period, when the current period
+// starts at current. It also returns the streak through the current period.
+func summarizeGoal(goal *logGoal, streak goalStreak, totals []periodTotal, current time.Time) (*goalStatus, goalStreak) {
+	status := &goalStatus{LongestStreak: streak.Longest}
+	previousPeriod := addPeriods(current, goal.Period, -1)
+	next := goalStreak{Through: current, Longest: streak.Longest}
+
+	run := streak.Run
+	last := addPeriods(streak.Through, goal.Period, -1)
+	if run > 0 && last.Equal(previousPeriod) {
+		next.Run = run
+	}
+	for _, t := range totals {
+		if t.Start.Equal(current) {
+			status.Progress = t.Total
+		}
+		if t.Total < goal.Target {
+			run = 0
+			continue
+		}
+		if run > 0 && addPeriods(last, goal.Period, 1).Equal(t.Start) {
+			run++
+		} else {
+			run = 1
+		}
+		last = t.Start
+		status.LongestStreak = max(status.LongestStreak, run)
+		if t.Start.Before(current) {
+			next.Longest = max(next.Longest, run)
+		}
+		switch {
+		case t.Start.Equal(current):
+			status.Met = true
+			status.CurrentStreak = run
+		case t.Start.Equal(previousPeriod):
+			next.Run = run
+		}
+	}
+
+	if !status.Met {
+		status.CurrentStreak = next.Run
+	}
+	return status, next
+}
+
+// goalLog is a log whose goal status is to be loaded.
+type goalLog struct {
+	LogID  string
+	Goal   *logGoal
+	Fields []fieldDefinition
+}
+
+// loadGoalStatus computes the status of goal for the log logID at now. It
+// returns nil if the goal's field no longer exists.
+func loadGoalStatus(ctx context.Context, pool *pgxpool.Pool, logID string, goal *logGoal, fields []fieldDefinition, now time.Time) (*goalStatus, error) {
+	statuses, err := loadGoalStatuses(ctx, pool, []goalLog{{LogID: logID, Goal: goal, Fields: fields}}, now)
+	if err != nil {
+		return nil, err
+	}
+	return statuses[0], nil
+}
+
+// loadGoalStatuses computes the status of the goal of each of logs at now. A
+// status is nil if the goal's field no longer exists.
+//
+// The streaks of periods before the current one are cached in goal_streaks,
+// so usually only the current period's entries are read. Writes to entries in
+// cached periods delete the cache with clearGoalStreak.
+func loadGoalStatuses(ctx context.Context, pool *pgxpool.Pool, logs []goalLog, now time.Time) ([]*goalStatus, error) {
+	statuses := make([]*goalStatus, len(logs))
+	locs := make([]*time.Location, len(logs))
+	// Goals are passed as parallel arrays. An empty field name counts
+	// entries instead of summing a field.
+	var indexes []int
+	var logIDs, periods, tzs, fieldNames []string
+	for i, l := range logs {
+		loc, err := loadTimeZone(l.Goal.TZ)
+		if err != nil {
+			return nil, err
+		}
+		locs[i] = loc
+
+		var fieldName string
+		if l.Goal.FieldID != "" {
+			field := goalField(l.Goal, l.Fields)
+			if field == nil {
+				continue
+			}
+			fieldName = field.Name
+		}
+		indexes = append(indexes, i)
+		logIDs = append(logIDs, l.LogID)
+		periods = append(periods, l.Goal.Period)
+		tzs = append(tzs, l.Goal.TZ)
+		fieldNames = append(fieldNames, fieldName)
+	}
+	if len(indexes) == 0 {
+		return statuses, nil
+	}
+
+	currents := make([]time.Time, len(indexes))
+	for j, i := range indexes {
+		currents[j] = truncatePeriod(now.In(locs[i]), logs[i].Goal.Period)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	streaks, err := loadGoalStreaks(ctx, tx, logs, indexes, locs, currents)
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for j := range indexes {
+		if !streaks[j].Through.Equal(currents[j]) {
+			stale = append(stale, logIDs[j])
+		}
+	}
+	if len(stale) > 0 {
+		// Entry writes hold a share lock on the log row until they commit.
+		// Waiting for them, and keeping new ones out until the streaks are
+		// saved, means the totals below include every entry in the periods
+		// being cached.
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM logs WHERE id = ANY($1) ORDER BY id FOR UPDATE`, stale); err != nil {
+			return nil, err
+		}
+		streaks, err = loadGoalStreaks(ctx, tx, logs, indexes, locs, currents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	since := make([]*time.Time, len(indexes))
+	for j, i := range indexes {
+		if !streaks[j].Through.IsZero() {
+			t := periodStartIn(streaks[j].Through, locs[i])
+			since[j] = &t
+		}
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT g.i, date_trunc(g.period, le.occurred_at AT TIME ZONE g.tz),
+			CASE WHEN g.field = '' THEN count(*)::float8 ELSE coalesce(sum(`+numericFieldSQL("g.field")+`), 0)::float8 END
+		 FROM unnest($1::uuid[], $2::text[], $3::text[], $4::text[], $5::timestamptz[]) WITH ORDINALITY AS g(log_id, period, tz, field, since, i)
+		 JOIN log_entries le ON le.log_id = g.log_id AND (g.since IS NULL OR le.occurred_at >= g.since)
+		 GROUP BY g.i, g.field, 2
+		 ORDER BY 1, 2`,
+		logIDs, periods, tzs, fieldNames, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make([][]periodTotal, len(indexes))
+	for rows.Next() {
+		var ordinal int
+		var t periodTotal
+		if err := rows.Scan(&ordinal, &t.Start, &t.Total); err != nil {
+			return nil, err
+		}
+		// WITH ORDINALITY numbers the goals from 1.
+		totals[ordinal-1] = append(totals[ordinal-1], t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	batch := &pgx.Batch{}
+	for j, i := range indexes {
+		goal := logs[i].Goal
+		loc := locs[i]
+		status, next := summarizeGoal(goal, streaks[j], totals[j], currents[j])
+		status.PeriodStart = periodStartIn(currents[j], loc)
+		statuses[i] = status
+
+		if !streaks[j].Through.Equal(currents[j]) {
+			batch.Queue(
+				`INSERT INTO goal_streaks (log_id, goal, through, longest, run) VALUES ($1, $2, $3, $4, $5)
+				 ON CONFLICT (log_id) DO UPDATE SET goal = excluded.goal, through = excluded.through, longest = excluded.longest, run = excluded.run`,
+				logIDs[j], goal, status.PeriodStart, next.Longest, next.Run,
+			)
+		}
+	}
+	if batch.Len() > 0 {
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// loadGoalStreaks returns the cached streak of the goal of logs[indexes[j]]
+// at j, or the zero goalStreak if it has none, or has one cached for a
+// different goal or running past the current period currents[j].
+func loadGoalStreaks(ctx context.Context, tx pgx.Tx, logs []goalLog, indexes []int, locs []*time.Location, currents []time.Time) ([]goalStreak, error) {
+	byLogID := make(map[string]int, len(indexes))
+	logIDs := make([]string, len(indexes))
+	for j, i := range indexes {
+		byLogID[logs[i].LogID] = j
+		logIDs[j] = logs[i].LogID
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT log_id, goal, through, longest, run FROM goal_streaks WHERE log_id = ANY($1)`,
+		logIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	streaks := make([]goalStreak, len(indexes))
+	for rows.Next() {
+		var logID string
+		var goal logGoal
+		var through time.Time
+		var streak goalStreak
+		if err := rows.Scan(&logID, &goal, &through, &streak.Longest, &streak.Run); err != nil {
+			return nil, err
+		}
+		j := byLogID[logID]
+		i := indexes[j]
+		if goal != *logs[i].Goal {
+			continue
+		}
+		streak.Through = truncatePeriod(through.In(locs[i]), goal.Period)
+		if streak.Through.After(currents[j]) {
+			continue
+		}
+		streaks[j] = streak
+	}
+	return streaks, rows.Err()
+}
+
+// periodStartIn returns the time in loc at which the period starting at the
+// wall clock time start, held in UTC, begins.
+func periodStartIn(start time.Time, loc *time.Location) time.Time {
+	return time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+}
+
+// clearGoalStreak deletes the cached goal streak of logID if the entry write
+// in tx that touched an entry occurring at occurredAt changes the periods it
+// covers. tx must hold a share lock on the log row, as lockLogFields takes.
+func clearGoalStreak(ctx context.Context, tx pgx.Tx, logID string, occurredAt time.Time) error {
+	_, err := tx.Exec(ctx, `DELETE FROM goal_streaks WHERE log_id = $1 AND through > $2`, logID, occurredAt)
+	return err
+}
+
+// handleSetLogGoal sets or replaces the goal of a log. Only the owner may set
+// it.
+func handleSetLogGoal(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		logID := chi.URLParam(r, "logID")
+
+		var goal logGoal
+		if err := json.NewDecoder(r.Body).Decode(&goal); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+
+		tx, err := pool.Begin(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer tx.Rollback(r.Context())
+
+		var fields []fieldDefinition
+		err = tx.QueryRow(r.Context(),
+			`SELECT fields FROM logs WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+			logID, user.ID,
+		).Scan(&fields)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		if err := validateGoal(&goal, fields); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if _, err := tx.Exec(r.Context(), `UPDATE logs SET goal = $1, updated_at = now() WHERE id = $2`, goal, logID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if err := tx.Commit(r.Context()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		status, err := loadGoalStatus(r.Context(), pool, logID, &goal, fields, time.Now())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, goalResponse{Goal: &goal, GoalStatus: status})
+	}
+}
+
+// handleDeleteLogGoal removes the goal of a log. Only the owner may remove it.
+func handleDeleteLogGoal(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		logID := chi.URLParam(r, "logID")
+
+		tag, err := pool.Exec(r.Context(),
+			`UPDATE logs SET goal = NULL, updated_at = now() WHERE id = $1 AND user_id = $2`,
+			logID, user.ID,
+		)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,232 @@
+package backend
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncatePeriod(t *testing.T) {
+	// A Sunday evening.
+	ts := time.Date(2025, 3, 9, 21, 30, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC), truncatePeriod(ts, "day"))
+	assert.Equal(t, time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), truncatePeriod(ts, "week"))
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), truncatePeriod(ts, "month"))
+
+	// Mondays start their own week.
+	monday := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), truncatePeriod(monday, "week"))
+}
+
+func TestSummarizeGoal(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	goal := &logGoal{Period: "day", Target: 2}
+	totals := []periodTotal{
+		{day(1), 2}, {day(2), 3}, {day(3), 2}, // Longest streak.
+		{day(4), 1},
+		{day(6), 2}, {day(7), 5},
+	}
+
+	// The current period is not met yet, so the streak through yesterday
+	// still counts.
+	status, _ := summarizeGoal(goal, goalStreak{}, append(totals, periodTotal{day(8), 1}), day(8))
+	assert.Equal(t, 1.0, status.Progress)
+	assert.False(t, status.Met)
+	assert.Equal(t, 2, status.CurrentStreak)
+	assert.Equal(t, 3, status.LongestStreak)
+
+	status, _ = summarizeGoal(goal, goalStreak{}, append(totals, periodTotal{day(8), 2}), day(8))
+	assert.True(t, status.Met)
+	assert.Equal(t, 3, status.CurrentStreak)
+	assert.Equal(t, 3, status.LongestStreak)
+
+	// A missed period ends the streak.
+	status, _ = summarizeGoal(goal, goalStreak{}, totals, day(9))
+	assert.Equal(t, 0.0, status.Progress)
+	assert.Equal(t, 0, status.CurrentStreak)
+
+	monthly := &logGoal{Period: "month", Target: 1}
+	status, _ = summarizeGoal(monthly, goalStreak{}, []periodTotal{
+		{time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 4},
+	}, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 2, status.CurrentStreak)
+	assert.Equal(t, 2, status.LongestStreak)
+
+	// The streak through an earlier period continues from the totals of the
+	// periods after it.
+	_, streak := summarizeGoal(goal, goalStreak{}, totals[:5], day(7))
+	assert.Equal(t, goalStreak{Through: day(7), Longest: 3, Run: 1}, streak)
+	status, streak = summarizeGoal(goal, streak, []periodTotal{{day(7), 5}, {day(8), 1}}, day(8))
+	assert.False(t, status.Met)
+	assert.Equal(t, 2, status.CurrentStreak)
+	assert.Equal(t, 3, status.LongestStreak)
+	assert.Equal(t, goalStreak{Through: day(8), Longest: 3, Run: 2}, streak)
+	status, _ = summarizeGoal(goal, streak, []periodTotal{{day(8), 2}}, day(8))
+	assert.True(t, status.Met)
+	assert.Equal(t, 3, status.CurrentStreak)
+	status, _ = summarizeGoal(goal, streak, nil, day(9))
+	assert.Equal(t, 0, status.CurrentStreak)
+	assert.Equal(t, 3, status.LongestStreak)
+}
+
+func TestValidateGoal(t *testing.T) {
+	goal := logGoal{Period: "week", Target: 3}
+	require.NoError(t, validateGoal(&goal, nil))
+	assert.Equal(t, "UTC", goal.TZ)
+
+	for _, goal := range []logGoal{
+		{Period: "year", Target: 1},
+		{Period: "day", Target: 0},
+		{Period: "day", Target: 1, FieldID: "missing"},
+		{Period: "day", Target: 1, TZ: "Mars/Olympus_Mons"},
+		{Period: "day", Target: 1, TZ: "Local"},
+	} {
+		assert.Error(t, validateGoal(&goal, nil))
+	}
+}
+
+func TestLogGoal(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	alice := registerUser(t, srv.URL, "alice")
+	bob := registerUser(t, srv.URL, "bob")
+	logID := createSharedLog(t, srv.URL, "Pushups", alice, bob)
+
+	resp, updated := putJSON(srv.URL+"/api/logs/"+logID, map[string]any{
+		"name":   "Pushups",
+		"fields": []map[string]any{{"name": "reps", "type": "number"}},
+	}, alice)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	fieldID := updated["fields"].([]any)[0].(map[string]any)["id"].(string)
+
+	now := time.Now().UTC()
+	for _, e := range []struct {
+		occurredAt time.Time
+		reps       string
+	}{
+		{now.AddDate(0, 0, -2), "100"},
+		{now.AddDate(0, 0, -1), "60"},
+		{now.AddDate(0, 0, -1), "50"},
+		{now, "40"},
+	} {
+		resp, _ := postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{
+			"fields":      map[string]any{"reps": e.reps},
+			"occurred_at": e.occurredAt,
+		}, alice)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	// Only the owner can set the goal.
+	resp, _ = putJSON(srv.URL+"/api/logs/"+logID+"/goal", map[string]any{"period": "day", "target": 1}, bob)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body := putJSON(srv.URL+"/api/logs/"+logID+"/goal", map[string]any{"period": "year", "target": 1}, alice)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "period")
+	resp, body = putJSON(srv.URL+"/api/logs/"+logID+"/goal", map[string]any{"period": "day", "target": 1, "tz": "Local"}, alice)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "tz")
+
+	resp, body = putJSON(srv.URL+"/api/logs/"+logID+"/goal", map[string]any{"period": "day", "target": 100, "field_id": fieldID}, alice)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, map[string]any{"period": "day", "target": 100.0, "field_id": fieldID, "tz": "UTC"}, body["goal"])
+	status := body["goal_status"].(map[string]any)
+	assert.Equal(t, 40.0, status["progress"])
+	assert.Equal(t, false, status["met"])
+	assert.Equal(t, 2.0, status["current_streak"])
+	assert.Equal(t, 2.0, status["longest_streak"])
+
+	// Shared members see the same state. Bob's own log with a weekly goal is
+	// listed alongside it.
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Walks"}, bob)
+	bobLogID := created["id"].(string)
+	postJSON(srv.URL+"/api/logs/"+bobLogID+"/entries", map[string]any{}, bob)
+	resp, _ = putJSON(srv.URL+"/api/logs/"+bobLogID+"/goal", map[string]any{"period": "week", "target": 3, "tz": "America/Chicago"}, bob)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, logs := getJSONArray(srv.URL+"/api/logs", bob)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, logs, 2)
+	assert.Equal(t, status, logs[0]["goal_status"])
+	assert.Equal(t, "Walks", logs[1]["name"])
+	assert.Equal(t, 1.0, logs[1]["goal_status"].(map[string]any)["progress"])
+
+	resp, body = putJSON(srv.URL+"/api/logs/"+logID+"/goal", map[string]any{"period": "day", "target": 1}, alice)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	status = body["goal_status"].(map[string]any)
+	assert.Equal(t, 1.0, status["progress"])
+	assert.Equal(t, true, status["met"])
+	assert.Equal(t, 3.0, status["current_streak"])
+
+	resp, body = getJSON(srv.URL+"/api/logs/"+logID, bob)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, status, body["goal_status"])
+
+	// Deleting the goal's field removes the goal.
+	resp, _ = putJSON(srv.URL+"/api/logs/"+logID+"/goal", map[string]any{"period": "day", "target": 100, "field_id": fieldID}, alice)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, body = putJSON(srv.URL+"/api/logs/"+logID, map[string]any{"name": "Pushups", "fields": []map[string]any{}, "confirm_delete": true}, alice)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, body["goal"])
+
+	resp, _ = putJSON(srv.URL+"/api/logs/"+logID+"/goal", map[string]any{"period": "week", "target": 3}, alice)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = deleteJSON(srv.URL+"/api/logs/"+logID+"/goal", alice)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	_, body = getJSON(srv.URL+"/api/logs/"+logID, alice)
+	assert.Nil(t, body["goal"])
+	assert.Nil(t, body["goal_status"])
+}
+
+func TestLogGoal_EarlierEntriesUpdateCachedStreak(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Walks"}, cookies)
+	logID := created["id"].(string)
+
+	now := time.Now().UTC()
+	addEntry := func(daysAgo int) string {
+		t.Helper()
+		resp, entry := postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{
+			"occurred_at": now.AddDate(0, 0, -daysAgo),
+		}, cookies)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		return entry["id"].(string)
+	}
+	streaks := func() (current, longest float64) {
+		t.Helper()
+		_, logs := getJSONArray(srv.URL+"/api/logs", cookies)
+		require.Len(t, logs, 1)
+		status := logs[0]["goal_status"].(map[string]any)
+		return status["current_streak"].(float64), status["longest_streak"].(float64)
+	}
+
+	addEntry(1)
+	middle := addEntry(2)
+	resp, _ := putJSON(srv.URL+"/api/logs/"+logID+"/goal", map[string]any{"period": "day", "target": 1}, cookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	current, longest := streaks()
+	assert.Equal(t, 2.0, current)
+	assert.Equal(t, 2.0, longest)
+
+	// Entries in periods before the current one are reflected even after the
+	// earlier periods' streak has been cached.
+	addEntry(3)
+	current, longest = streaks()
+	assert.Equal(t, 3.0, current)
+	assert.Equal(t, 3.0, longest)
+
+	resp, _ = deleteJSON(srv.URL+"/api/logs/"+logID+"/entries/"+middle, cookies)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	current, longest = streaks()
+	assert.Equal(t, 1.0, current)
+	assert.Equal(t, 1.0, longest)
+}
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+var errIdempotencyKeyReused = errors.New("idempotency key was already used for a different log")
+
+// claimIdempotencyKey reserves key for userID within tx. If the key is new it
+// returns nil and the caller must store its response with
+// saveIdempotentResponse before committing. If the key was already used it
+// returns the stored response. A concurrent request with the same key blocks
+// until the first request's transaction finishes.
+func claimIdempotencyKey(ctx context.Context, tx pgx.Tx, userID, key, logID string) (*logEntryResponse, error) {
+	// Clean up the user's expired keys opportunistically. Other users' keys are
+	// left alone so concurrent requests from different users don't contend.
+	_, err := tx.Exec(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1 AND expires_at < now()`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO idempotency_keys (user_id, key, log_id) VALUES ($1, $2, $3)
+		 ON CONFLICT DO NOTHING`,
+		userID, key, logID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	var storedLogID string
+	var response logEntryResponse
+	err = tx.QueryRow(ctx,
+		`SELECT log_id, response FROM idempotency_keys WHERE user_id = $1 AND key = $2`,
+		userID, key,
+	).Scan(&storedLogID, &response)
+	if err != nil {
+		return nil, err
+	}
+	if storedLogID != logID {
+		return nil, errIdempotencyKeyReused
+	}
+	return &response, nil
+}
+
+func saveIdempotentResponse(ctx context.Context, tx pgx.Tx, userID, key string, response logEntryResponse) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE idempotency_keys SET response = $1 WHERE user_id = $2 AND key = $3`,
+		response, userID, key,
+	)
+	return err
+}
@@ -0,0 +1,127 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func postJSONWithIdempotencyKey(url string, body any, key string, cookies []*http.Cookie) (*http.Response, map[string]any) {
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", url, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyKeyHeader, key)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, _ := http.DefaultClient.Do(req)
+	var result map[string]any
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	return resp, result
+}
+
+func TestCreateLogEntry_IdempotencyKeyReplay(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Vitamins"}, cookies)
+	logID := created["id"].(string)
+
+	resp1, body1 := postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{}, "retry-1", cookies)
+	assert.Equal(t, http.StatusCreated, resp1.StatusCode)
+	assert.Empty(t, resp1.Header.Get("Idempotent-Replayed"))
+
+	resp2, body2 := postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{}, "retry-1", cookies)
+	assert.Equal(t, http.StatusCreated, resp2.StatusCode)
+	assert.Equal(t, "true", resp2.Header.Get("Idempotent-Replayed"))
+	assert.Equal(t, body1["id"], body2["id"])
+	assert.Equal(t, body1["occurred_at"], body2["occurred_at"])
+	assert.Equal(t, "alice", body2["username"])
+
+	_, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", cookies)
+	assert.Len(t, entries, 1)
+}
+
+func TestCreateLogEntry_DifferentIdempotencyKeys(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Vitamins"}, cookies)
+	logID := created["id"].(string)
+
+	_, body1 := postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{}, "key-1", cookies)
+	_, body2 := postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{}, "key-2", cookies)
+	assert.NotEqual(t, body1["id"], body2["id"])
+
+	_, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", cookies)
+	assert.Len(t, entries, 2)
+}
+
+func TestCreateLogEntry_IdempotencyKeysArePerUser(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	aliceCookies := registerUser(t, srv.URL, "alice")
+	bobCookies := registerUser(t, srv.URL, "bob")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Shared Log"}, aliceCookies)
+	logID := created["id"].(string)
+
+	_, tokenBody := postJSON(srv.URL+"/api/logs/"+logID+"/share-token", map[string]any{}, aliceCookies)
+	postJSON(srv.URL+"/api/join/"+tokenBody["share_token"].(string), map[string]any{}, bobCookies)
+
+	_, aliceEntry := postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{}, "same-key", aliceCookies)
+	resp, bobEntry := postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{}, "same-key", bobCookies)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.NotEqual(t, aliceEntry["id"], bobEntry["id"])
+	assert.Equal(t, "bob", bobEntry["username"])
+}
+
+func TestCreateLogEntry_IdempotencyKeyReusedForDifferentLog(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, log1 := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Vitamins"}, cookies)
+	_, log2 := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Pushups"}, cookies)
+
+	postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+log1["id"].(string)+"/entries", map[string]any{}, "key-1", cookies)
+	resp, body := postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+log2["id"].(string)+"/entries", map[string]any{}, "key-1", cookies)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Contains(t, body["error"], "different log")
+}
+
+func TestCreateLogEntry_InvalidEntryDoesNotConsumeIdempotencyKey(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{
+		"name": "Pushups",
+		"fields": []map[string]any{
+			{"name": "count", "type": "number", "required": true},
+		},
+	}, cookies)
+	logID := created["id"].(string)
+
+	resp, _ := postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{}, "key-1", cookies)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body := postJSONWithIdempotencyKey(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{
+		"fields": map[string]any{"count": "10"},
+	}, "key-1", cookies)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "10", body["fields"].(map[string]any)["count"])
+}
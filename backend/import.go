@@ -0,0 +1,330 @@
+package backend
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxImportBytes = 10 << 20
+
+type importCSVRequest struct {
+	CSV string `json:"csv"`
+	// Columns maps CSV header names to field names. When omitted, columns are
+	// matched to fields by name, ignoring case.
+	Columns map[string]string `json:"columns"`
+	// OccurredAtColumn is the CSV header holding each entry's timestamp. It
+	// defaults to "occurred_at". Rows without a timestamp are logged as now.
+	OccurredAtColumn string `json:"occurred_at_column"`
+	// TimestampFormat is "rfc3339" (default), "unix", or a Go time layout such
+	// as "2006-01-02 15:04".
+	TimestampFormat string `json:"timestamp_format"`
+	// Timezone is the IANA time zone for timestamps without an offset.
+	Timezone string `json:"timezone"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+type importRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type importCSVResponse struct {
+	DryRun   bool             `json:"dry_run"`
+	Imported int              `json:"imported"`
+	Errors   []importRowError `json:"errors"`
+}
+
+// handleImportLogEntriesCSV imports CSV rows as entries in a log. Every row is
+// validated before anything is written and the rows are inserted in a single
+// transaction. Row numbers in errors count the header as row 1 to match what
+// a spreadsheet shows. With dry_run set nothing is written and the response
+// reports how many rows would be imported.
+func handleImportLogEntriesCSV(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		logID := chi.URLParam(r, "logID")
+
+		var req importCSVRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		if req.OccurredAtColumn == "" {
+			req.OccurredAtColumn = "occurred_at"
+		}
+
+		loc, err := loadTimeZone(req.Timezone)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		access, err := checkLogAccess(r.Context(), pool, logID, user.ID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		cr := csv.NewReader(strings.NewReader(req.CSV))
+		header, err := cr.Read()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "csv must have a header row"})
+			return
+		}
+
+		columns, occurredAtIndex, err := mapImportColumns(header, access.Fields, req.Columns, req.OccurredAtColumn)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		var items []batchEntryItem
+		var rowErrors []importRowError
+		for row := 2; ; row++ {
+			record, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) && !errors.Is(err, csv.ErrFieldCount) {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("row %d: %v", row, parseErr.Err)})
+					return
+				}
+				rowErrors = append(rowErrors, importRowError{Row: row, Error: "wrong number of columns"})
+				continue
+			}
+
+			item := batchEntryItem{LogID: logID, Fields: map[string]any{}}
+			if occurredAtIndex >= 0 && strings.TrimSpace(record[occurredAtIndex]) != "" {
+				occurredAt, err := parseImportTimestamp(strings.TrimSpace(record[occurredAtIndex]), req.TimestampFormat, loc)
+				if err != nil {
+					rowErrors = append(rowErrors, importRowError{Row: row, Error: "invalid occurred_at: " + record[occurredAtIndex]})
+					continue
+				}
+				if err := validateOccurredAt(occurredAt); err != nil {
+					rowErrors = append(rowErrors, importRowError{Row: row, Error: err.Error()})
+					continue
+				}
+				item.OccurredAt = &occurredAt
+			}
+
+			var convErr error
+			for i, def := range columns {
+				if def == nil {
+					continue
+				}
+				v, err := parseImportFieldValue(*def, record[i], loc)
+				if err != nil {
+					convErr = err
+					break
+				}
+				if v != nil {
+					item.Fields[def.Name] = v
+				}
+			}
+			if convErr == nil {
+				// Imported rows are history, so they may fill fields that
+				// have since been archived, as the entries they recreate did.
+				convErr = validateUpdatedFieldValues(access.Fields, item.Fields, item.Fields)
+			}
+			if convErr != nil {
+				rowErrors = append(rowErrors, importRowError{Row: row, Error: convErr.Error()})
+				continue
+			}
+
+			items = append(items, item)
+		}
+
+		resp := importCSVResponse{DryRun: req.DryRun, Imported: len(items), Errors: rowErrors}
+		if resp.Errors == nil {
+			resp.Errors = []importRowError{}
+		}
+
+		if req.DryRun {
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		if len(rowErrors) > 0 {
+			resp.Imported = 0
+			writeJSON(w, http.StatusBadRequest, resp)
+			return
+		}
+		if len(items) == 0 {
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+
+		tx, err := pool.Begin(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer tx.Rollback(r.Context())
+
+		if err := lockLogFields(r.Context(), tx, logID, access.Fields); err != nil {
+			switch {
+			case errors.Is(err, errLogFieldsChanged):
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			case errors.Is(err, pgx.ErrNoRows):
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+			default:
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			}
+			return
+		}
+
+		if _, err := insertLogEntries(r.Context(), tx, user, items); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		if err := tx.Commit(r.Context()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, resp)
+	}
+}
+
+// mapImportColumns resolves each CSV column to the field definition it fills,
+// or nil when the column is ignored. It also returns the index of the
+// occurred_at column, or -1 if the CSV has none.
+func mapImportColumns(header []string, fields []fieldDefinition, mapping map[string]string, occurredAtColumn string) ([]*fieldDefinition, int, error) {
+	defMap := make(map[string]*fieldDefinition)
+	for i := range fields {
+		defMap[strings.ToLower(fields[i].Name)] = &fields[i]
+	}
+
+	columns := make([]*fieldDefinition, len(header))
+	occurredAtIndex := -1
+	mapped := make(map[string]bool)
+	filled := make(map[*fieldDefinition]string)
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if h == occurredAtColumn {
+			occurredAtIndex = i
+			continue
+		}
+		name := h
+		if mapping != nil {
+			var ok bool
+			name, ok = mapping[h]
+			if !ok {
+				continue
+			}
+			mapped[h] = true
+		}
+		def, ok := defMap[strings.ToLower(name)]
+		if !ok {
+			if mapping != nil {
+				return nil, -1, fmt.Errorf("unknown field: %s", name)
+			}
+			continue
+		}
+		if other, ok := filled[def]; ok {
+			return nil, -1, fmt.Errorf("columns %s and %s both map to field %s", other, h, def.Name)
+		}
+		filled[def] = h
+		columns[i] = def
+	}
+
+	for h := range mapping {
+		if !mapped[h] {
+			return nil, -1, fmt.Errorf("column not found in csv: %s", h)
+		}
+	}
+
+	return columns, occurredAtIndex, nil
+}
+
+func parseImportTimestamp(s, format string, loc *time.Location) (time.Time, error) {
+	switch format {
+	case "", "rfc3339":
+		return time.Parse(time.RFC3339Nano, s)
+	case "unix":
+		secs, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(secs, 0), nil
+	default:
+		return time.ParseInLocation(format, s, loc)
+	}
+}
+
+// parseImportFieldValue converts a CSV cell to the value stored for def. Blank
+// cells return nil so the field is omitted from the entry. Select cells may
+// hold an option's label or ID, and multiselect cells a comma separated list
+// of them. Datetime cells without a time zone offset are interpreted in loc.
+func parseImportFieldValue(def fieldDefinition, cell string, loc *time.Location) (any, error) {
+	if strings.TrimSpace(cell) == "" {
+		return nil, nil
+	}
+	switch def.Type {
+	case "boolean":
+		switch strings.ToLower(strings.TrimSpace(cell)) {
+		case "true", "yes", "y", "1":
+			return true, nil
+		case "false", "no", "n", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("field %q must be true or false", def.Name)
+	case "number":
+		return strings.TrimSpace(cell), nil
+	case "text":
+		return unescapeCSVFormula(cell), nil
+	case "select":
+		opt := findSelectOptionByLabel(def.Options, unescapeCSVFormula(cell))
+		if opt == nil {
+			return nil, fmt.Errorf("field %q must be one of its options", def.Name)
+		}
+		return opt.ID, nil
+	case "datetime":
+		cell = strings.TrimSpace(cell)
+		if t, err := parseDatetimeValue(cell); err == nil {
+			return formatDatetimeValue(t), nil
+		}
+		for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+			if t, err := time.ParseInLocation(layout, cell, loc); err == nil {
+				return formatDatetimeValue(t), nil
+			}
+		}
+		return nil, fmt.Errorf("field %q must be a timestamp", def.Name)
+	case "multiselect":
+		ids, err := parseOptionList(def, unescapeCSVFormula(cell))
+		if err != nil {
+			return nil, err
+		}
+		v := make([]any, len(ids))
+		for i, id := range ids {
+			v[i] = id
+		}
+		return v, nil
+	}
+	return cell, nil
+}
+
+// unescapeCSVFormula undoes the formula escaping applied by the CSV export.
+func unescapeCSVFormula(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
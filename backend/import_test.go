@@ -0,0 +1,273 @@
+package backend
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createImportTestLog(t *testing.T, srvURL string, cookies []*http.Cookie) string {
+	t.Helper()
+	resp, created := postJSON(srvURL+"/api/logs", map[string]any{
+		"name": "Pushups",
+		"fields": []map[string]any{
+			{"name": "count", "type": "number", "required": true},
+			{"name": "notes", "type": "text"},
+			{"name": "fasted", "type": "boolean"},
+		},
+	}, cookies)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	return created["id"].(string)
+}
+
+func TestImportLogEntriesCSV_Success(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+	logID := createImportTestLog(t, srv.URL, cookies)
+
+	resp, body := postJSON(srv.URL+"/api/logs/"+logID+"/import", map[string]any{
+		"csv": "occurred_at,Count,notes,fasted\n" +
+			"2025-06-14T08:00:00Z,25,morning,yes\n" +
+			"2025-06-15T08:00:00Z,30,,\n",
+	}, cookies)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, float64(2), body["imported"])
+	assert.Len(t, body["errors"], 0)
+
+	_, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", cookies)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "2025-06-15T08:00:00Z", entries[0]["occurred_at"])
+	assert.Equal(t, map[string]any{"count": "30"}, entries[0]["fields"])
+	assert.Equal(t, map[string]any{"count": "25", "notes": "morning", "fasted": true}, entries[1]["fields"])
+}
+
+func TestImportLogEntriesCSV_ColumnMappingAndTimezone(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+	logID := createImportTestLog(t, srv.URL, cookies)
+
+	resp, body := postJSON(srv.URL+"/api/logs/"+logID+"/import", map[string]any{
+		"csv":                "Date,Reps,Comment\n06/14/2025 08:00,25,first\n",
+		"columns":            map[string]string{"Reps": "count", "Comment": "notes"},
+		"occurred_at_column": "Date",
+		"timestamp_format":   "01/02/2006 15:04",
+		"timezone":           "America/Chicago",
+	}, cookies)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, float64(1), body["imported"])
+
+	_, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", cookies)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "2025-06-14T13:00:00Z", entries[0]["occurred_at"])
+	assert.Equal(t, map[string]any{"count": "25", "notes": "first"}, entries[0]["fields"])
+}
+
+func TestImportLogEntriesCSV_InvalidRowsInsertNothing(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+	logID := createImportTestLog(t, srv.URL, cookies)
+
+	resp, body := postJSON(srv.URL+"/api/logs/"+logID+"/import", map[string]any{
+		"csv": "occurred_at,count\n" +
+			"2025-06-14T08:00:00Z,25\n" +
+			"2025-06-15T08:00:00Z,lots\n" +
+			"yesterday,10\n",
+	}, cookies)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	errs := body["errors"].([]any)
+	require.Len(t, errs, 2)
+	assert.Equal(t, float64(3), errs[0].(map[string]any)["row"])
+	assert.Contains(t, errs[0].(map[string]any)["error"], "valid number")
+	assert.Equal(t, float64(4), errs[1].(map[string]any)["row"])
+	assert.Contains(t, errs[1].(map[string]any)["error"], "occurred_at")
+
+	_, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", cookies)
+	assert.Len(t, entries, 0)
+}
+
+func TestImportLogEntriesCSV_DryRun(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+	logID := createImportTestLog(t, srv.URL, cookies)
+
+	resp, body := postJSON(srv.URL+"/api/logs/"+logID+"/import", map[string]any{
+		"csv":     "count,fasted\n25,true\n,false\n30,maybe\n",
+		"dry_run": true,
+	}, cookies)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, true, body["dry_run"])
+	assert.Equal(t, float64(1), body["imported"])
+	assert.Len(t, body["errors"], 2)
+
+	_, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", cookies)
+	assert.Len(t, entries, 0)
+}
+
+func TestImportLogEntriesCSV_UnknownMappedField(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+	logID := createImportTestLog(t, srv.URL, cookies)
+
+	resp, body := postJSON(srv.URL+"/api/logs/"+logID+"/import", map[string]any{
+		"csv":     "Reps\n25\n",
+		"columns": map[string]string{"Reps": "reps"},
+	}, cookies)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "unknown field")
+}
+
+func TestImportLogEntriesCSV_DuplicateColumnMapping(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+	logID := createImportTestLog(t, srv.URL, cookies)
+
+	resp, body := postJSON(srv.URL+"/api/logs/"+logID+"/import", map[string]any{
+		"csv":     "Reps,Sets\n25,3\n",
+		"columns": map[string]string{"Reps": "count", "Sets": "count"},
+	}, cookies)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "both map to field count")
+}
+
+func TestImportLogEntriesCSV_ArchivedField(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+	logID := createImportTestLog(t, srv.URL, cookies)
+
+	_, log := getJSON(srv.URL+"/api/logs/"+logID, cookies)
+	fields := log["fields"].([]any)
+	for _, f := range fields {
+		if f.(map[string]any)["name"] == "notes" {
+			f.(map[string]any)["archived"] = true
+		}
+	}
+	resp, _ := putJSON(srv.URL+"/api/logs/"+logID, map[string]any{"name": "Pushups", "fields": fields}, cookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body := postJSON(srv.URL+"/api/logs/"+logID+"/import", map[string]any{
+		"csv": "occurred_at,count,notes\n2025-06-14T08:00:00Z,25,old note\n",
+	}, cookies)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, float64(1), body["imported"])
+
+	_, entries, _ := getEntryPage(srv.URL+"/api/logs/"+logID+"/entries", cookies)
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]any{"count": "25", "notes": "old note"}, entries[0]["fields"])
+}
+
+func TestImportLogEntriesCSV_OtherUsersLog(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	aliceCookies := registerUser(t, srv.URL, "alice")
+	bobCookies := registerUser(t, srv.URL, "bob")
+	logID := createImportTestLog(t, srv.URL, aliceCookies)
+
+	resp, _ := postJSON(srv.URL+"/api/logs/"+logID+"/import", map[string]any{
+		"csv": "count\n25\n",
+	}, bobCookies)
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestMapImportColumns(t *testing.T) {
+	fields := []fieldDefinition{
+		{Name: "count", Type: "number"},
+		{Name: "notes", Type: "text"},
+	}
+
+	columns, occurredAtIndex, err := mapImportColumns([]string{"occurred_at", "username", "Count", "notes"}, fields, nil, "occurred_at")
+	require.NoError(t, err)
+	assert.Equal(t, 0, occurredAtIndex)
+	assert.Nil(t, columns[1])
+	assert.Equal(t, "count", columns[2].Name)
+	assert.Equal(t, "notes", columns[3].Name)
+
+	_, _, err = mapImportColumns([]string{"Reps"}, fields, map[string]string{"Sets": "count"}, "occurred_at")
+	assert.ErrorContains(t, err, "column not found")
+
+	_, _, err = mapImportColumns([]string{"count", "Count"}, fields, nil, "occurred_at")
+	assert.ErrorContains(t, err, "both map to field count")
+}
+
+func TestParseImportTimestamp(t *testing.T) {
+	loc, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+
+	ts, err := parseImportTimestamp("2025-06-14 08:00", "2006-01-02 15:04", loc)
+	require.NoError(t, err)
+	assert.True(t, ts.Equal(time.Date(2025, 6, 14, 13, 0, 0, 0, time.UTC)))
+
+	ts, err = parseImportTimestamp("1749888000", "unix", loc)
+	require.NoError(t, err)
+	assert.True(t, ts.Equal(time.Date(2025, 6, 14, 8, 0, 0, 0, time.UTC)))
+
+	_, err = parseImportTimestamp("2025-06-14", "rfc3339", loc)
+	assert.Error(t, err)
+}
+
+func TestParseImportFieldValue(t *testing.T) {
+	v, err := parseImportFieldValue(fieldDefinition{Name: "fasted", Type: "boolean"}, "Yes", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, true, v)
+
+	_, err = parseImportFieldValue(fieldDefinition{Name: "fasted", Type: "boolean"}, "maybe", time.UTC)
+	assert.Error(t, err)
+
+	v, err = parseImportFieldValue(fieldDefinition{Name: "count", Type: "number"}, " 12 ", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, "12", v)
+
+	v, err = parseImportFieldValue(fieldDefinition{Name: "notes", Type: "text"}, "'=SUM(A1)", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, "=SUM(A1)", v)
+
+	v, err = parseImportFieldValue(fieldDefinition{Name: "notes", Type: "text"}, "", time.UTC)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	tags := fieldDefinition{Name: "tags", Type: "multiselect", Options: []selectOption{
+		{ID: "a", Label: "Morning"},
+		{ID: "b", Label: "Outdoors"},
+	}}
+	v, err = parseImportFieldValue(tags, "outdoors, a", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"b", "a"}, v)
+
+	_, err = parseImportFieldValue(tags, "Evening", time.UTC)
+	assert.Error(t, err)
+
+	chicago, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+	startedAt := fieldDefinition{Name: "started_at", Type: "datetime"}
+	v, err = parseImportFieldValue(startedAt, "2025-06-15 08:30", chicago)
+	require.NoError(t, err)
+	assert.Equal(t, "2025-06-15T13:30:00Z", v)
+
+	v, err = parseImportFieldValue(startedAt, "2025-06-15T08:30:00+02:00", chicago)
+	require.NoError(t, err)
+	assert.Equal(t, "2025-06-15T06:30:00Z", v)
+}
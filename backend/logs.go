@@ -1,30 +1,90 @@
 package backend
 
 import (
+	"cmp"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid/v5"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type fieldDefinition struct {
+	// ID identifies the field across renames. Entry values are keyed by Name.
+	ID       string `json:"id"`
 	Name     string `json:"name"`
 	Type     string `json:"type"`
 	Required bool   `json:"required"`
+	// Options lists the choices of a select or multiselect field.
+	Options []selectOption `json:"options,omitempty"`
+
+	// Min, Max, Step and Integer constrain the values of a number field. Step
+	// is measured from Min, or from zero when there is no Min.
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	Step    *float64 `json:"step,omitempty"`
+	Integer bool     `json:"integer,omitempty"`
+	// Unit is a label such as "kg" or "reps" shown with a number field.
+	Unit string `json:"unit,omitempty"`
+
+	// Default is the value given to the field when a new entry omits it.
+	// UseLastValue instead defaults the field to the value in the user's most
+	// recent entry that has one. At most one of them may be set.
+	Default      any  `json:"default,omitempty"`
+	UseLastValue bool `json:"use_last_value,omitempty"`
+
+	// Expression computes the value of a computed field from the entry's
+	// number and duration fields, such as "sets * reps".
+	Expression string `json:"expression,omitempty"`
+
+	// Description explains the field and Placeholder is shown in its empty
+	// input.
+	Description string `json:"description,omitempty"`
+	Placeholder string `json:"placeholder,omitempty"`
+	// Order sets the display position of the field. Fields are kept sorted
+	// by Order, and fields with the same Order keep the order they were given
+	// in.
+	Order int `json:"order,omitempty"`
+	// Archived hides a field from new entries without removing its values
+	// from existing ones. An archived field is never required.
+	Archived bool `json:"archived,omitempty"`
 }
 
 type createLogRequest struct {
 	Name   string            `json:"name"`
 	Fields []fieldDefinition `json:"fields"`
+	// ExpectedIntervalSeconds is how often entries are expected, if they are.
+	ExpectedIntervalSeconds *int `json:"expected_interval_seconds"`
+}
+
+type updateLogRequest struct {
+	Name   string            `json:"name"`
+	Fields []fieldDefinition `json:"fields"`
+	// ExpectedIntervalSeconds is left as it is when the key is missing.
+	ExpectedIntervalSeconds optionalInterval `json:"expected_interval_seconds"`
+	// DryRun previews the changes to existing entries without saving.
+	DryRun bool `json:"dry_run"`
+	// OnConversionError is abort, drop or keep. It decides what happens to
+	// entry values that cannot be converted when a field's type changes.
+	OnConversionError string `json:"on_conversion_error"`
+	// ConfirmDelete must be set to delete fields that hold values.
+	ConfirmDelete bool `json:"confirm_delete"`
+}
+
+type fieldMigrationPreview struct {
+	DryRun  bool           `json:"dry_run"`
+	Changes []*fieldChange `json:"changes"`
 }
 
 type logResponse struct {
@@ -33,12 +93,27 @@ type logResponse struct {
 	Fields     []fieldDefinition `json:"fields"`
 	IsOwner    bool              `json:"is_owner"`
 	ShareToken *string           `json:"share_token,omitempty"`
-	CreatedAt  time.Time         `json:"created_at"`
-	UpdatedAt  time.Time         `json:"updated_at"`
+	// Defaults holds the value each field with a default would be given in a
+	// new entry by the requesting user, keyed by field name.
+	Defaults map[string]any `json:"defaults,omitempty"`
+	// Goal is the log's goal, if it has one, and GoalStatus the progress
+	// towards it.
+	Goal       *logGoal    `json:"goal,omitempty"`
+	GoalStatus *goalStatus `json:"goal_status,omitempty"`
+	// ExpectedIntervalSeconds is how often entries are expected. NextDueAt is
+	// one interval after LastOccurredAt, the time of the latest entry, and
+	// Overdue reports whether it has passed.
+	ExpectedIntervalSeconds *int       `json:"expected_interval_seconds,omitempty"`
+	LastOccurredAt          *time.Time `json:"last_occurred_at"`
+	NextDueAt               *time.Time `json:"next_due_at,omitempty"`
+	Overdue                 bool       `json:"overdue"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
 }
 
 type createLogEntryRequest struct {
-	Fields map[string]any `json:"fields"`
+	Fields     map[string]any `json:"fields"`
+	OccurredAt *time.Time     `json:"occurred_at"`
 }
 
 type updateLogEntryRequest struct {
@@ -47,14 +122,31 @@ type updateLogEntryRequest struct {
 }
 
 type logEntryResponse struct {
-	ID         string         `json:"id"`
-	LogID      string         `json:"log_id"`
-	UserID     string         `json:"user_id"`
-	Username   string         `json:"username"`
-	Fields     map[string]any `json:"fields"`
-	OccurredAt time.Time      `json:"occurred_at"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
+	ID       string         `json:"id"`
+	LogID    string         `json:"log_id"`
+	UserID   *string        `json:"user_id"`
+	Username string         `json:"username"`
+	Fields   map[string]any `json:"fields"`
+	// FormattedFields holds display values for fields whose stored value is
+	// not meant to be shown as is, such as durations stored as seconds.
+	FormattedFields map[string]string `json:"formatted_fields,omitempty"`
+	// UnconvertedFields holds values kept when a field's type changed but the
+	// value could not be converted, keyed by field ID.
+	UnconvertedFields map[string]any `json:"unconverted_fields,omitempty"`
+	OccurredAt        time.Time      `json:"occurred_at"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// maxOccurredAtFutureSkew is how far past the server's clock a client supplied
+// occurred_at may be. It allows for modest clock drift on client devices.
+const maxOccurredAtFutureSkew = 5 * time.Minute
+
+func validateOccurredAt(t time.Time) error {
+	if t.After(time.Now().Add(maxOccurredAtFutureSkew)) {
+		return fmt.Errorf("occurred_at must not be in the future")
+	}
+	return nil
 }
 
 func validateFieldDefinitions(fields []fieldDefinition) error {
@@ -62,7 +154,18 @@ func validateFieldDefinitions(fields []fieldDefinition) error {
 		return fmt.Errorf("too many fields (max 20)")
 	}
 	seen := make(map[string]bool)
+	ids := make(map[string]bool)
 	for i, f := range fields {
+		if len(f.ID) > 36 {
+			return fmt.Errorf("field ids must be at most 36 characters")
+		}
+		if f.ID != "" {
+			if ids[f.ID] {
+				return fmt.Errorf("duplicate field id: %s", f.ID)
+			}
+			ids[f.ID] = true
+		}
+
 		f.Name = strings.TrimSpace(f.Name)
 		fields[i].Name = f.Name
 		if f.Name == "" {
@@ -76,14 +179,75 @@ func validateFieldDefinitions(fields []fieldDefinition) error {
 			return fmt.Errorf("duplicate field name: %s", f.Name)
 		}
 		seen[lower] = true
-		if f.Type != "text" && f.Type != "number" && f.Type != "boolean" {
-			return fmt.Errorf("field type must be 'text', 'number', or 'boolean'")
+		fields[i].Description = strings.TrimSpace(f.Description)
+		if len(fields[i].Description) > 500 {
+			return fmt.Errorf("field %q: description must be at most 500 characters", f.Name)
+		}
+		fields[i].Placeholder = strings.TrimSpace(f.Placeholder)
+		if len(fields[i].Placeholder) > 100 {
+			return fmt.Errorf("field %q: placeholder must be at most 100 characters", f.Name)
+		}
+		if f.Type == "number" {
+			if err := validateNumberConstraints(&fields[i]); err != nil {
+				return err
+			}
+		} else if f.Min != nil || f.Max != nil || f.Step != nil || f.Integer || f.Unit != "" {
+			return fmt.Errorf("field %q: min, max, step, integer and unit are only allowed on number fields", f.Name)
+		}
+		switch f.Type {
+		case "text", "number", "boolean", "duration", "date", "datetime", "computed":
+			if len(f.Options) > 0 {
+				return fmt.Errorf("field %q: options are only allowed on select and multiselect fields", f.Name)
+			}
+		case "select", "multiselect":
+			if err := validateSelectOptions(f.Name, fields[i].Options); err != nil {
+				return err
+			}
+			if f.Type == "multiselect" {
+				for _, o := range fields[i].Options {
+					if strings.Contains(o.Label, ",") {
+						return fmt.Errorf("field %q: option labels must not contain commas", f.Name)
+					}
+				}
+			}
+		default:
+			return fmt.Errorf("field type must be 'text', 'number', 'boolean', 'duration', 'date', 'datetime', 'select', 'multiselect', or 'computed'")
+		}
+		if err := validateFieldDefault(&fields[i]); err != nil {
+			return err
+		}
+	}
+	if err := validateComputedFields(fields); err != nil {
+		return err
+	}
+	slices.SortStableFunc(fields, func(a, b fieldDefinition) int {
+		return cmp.Compare(a.Order, b.Order)
+	})
+
+	for i := range fields {
+		for fields[i].ID == "" {
+			if id := newShortID(); !ids[id] {
+				fields[i].ID = id
+				ids[id] = true
+			}
 		}
 	}
 	return nil
 }
 
 func validateFieldValues(definitions []fieldDefinition, values map[string]any) error {
+	return validateUpdatedFieldValues(definitions, values, nil)
+}
+
+// validateUpdatedFieldValues validates the new values of an existing entry.
+// A retired option or a value for an archived field is accepted only when the
+// field already held a value in previous, so entries recorded before the
+// retirement can still be edited.
+// Values are rewritten in place to the form they are stored in: multiselect
+// values become the chosen option IDs in the field's option order, durations
+// become a number of seconds, and datetimes are converted to UTC. Computed
+// fields are then evaluated, replacing any value given for them.
+func validateUpdatedFieldValues(definitions []fieldDefinition, values, previous map[string]any) error {
 	if values == nil {
 		values = make(map[string]any)
 	}
@@ -101,6 +265,12 @@ func validateFieldValues(definitions []fieldDefinition, values map[string]any) e
 
 	for _, def := range definitions {
 		v, exists := values[def.Name]
+		if def.Archived {
+			if _, ok := previous[def.Name]; v != nil && !ok {
+				return fmt.Errorf("field %q is archived", def.Name)
+			}
+			def.Required = false
+		}
 		if !exists || v == nil {
 			if def.Required {
 				return fmt.Errorf("field %q is required", def.Name)
@@ -117,9 +287,13 @@ func validateFieldValues(definitions []fieldDefinition, values map[string]any) e
 				return fmt.Errorf("field %q is required", def.Name)
 			}
 			if strings.TrimSpace(s) != "" {
-				if _, err := strconv.ParseFloat(s, 64); err != nil {
+				n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				if err != nil {
 					return fmt.Errorf("field %q must be a valid number", def.Name)
 				}
+				if err := checkNumberConstraints(def, n); err != nil {
+					return err
+				}
 			}
 		case "text":
 			s, ok := v.(string)
@@ -133,8 +307,84 @@ func validateFieldValues(definitions []fieldDefinition, values map[string]any) e
 			if _, ok := v.(bool); !ok {
 				return fmt.Errorf("field %q must be true or false", def.Name)
 			}
+		case "select":
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("field %q must be an option id", def.Name)
+			}
+			if s == "" {
+				if def.Required {
+					return fmt.Errorf("field %q is required", def.Name)
+				}
+				continue
+			}
+			opt := findSelectOption(def.Options, s)
+			if opt == nil {
+				return fmt.Errorf("field %q must be one of its options", def.Name)
+			}
+			if opt.Retired && previous[def.Name] != s {
+				return fmt.Errorf("option %q of field %q is retired", opt.Label, def.Name)
+			}
+		case "duration":
+			var secs float64
+			switch v := v.(type) {
+			case float64:
+				if v < 0 {
+					return fmt.Errorf("field %q must not be negative", def.Name)
+				}
+				secs = v
+			case string:
+				if strings.TrimSpace(v) == "" {
+					if def.Required {
+						return fmt.Errorf("field %q is required", def.Name)
+					}
+					delete(values, def.Name)
+					continue
+				}
+				var err error
+				secs, err = parseDuration(v)
+				if err != nil {
+					return fmt.Errorf("field %q must be a duration such as \"1h20m\" or \"PT1H20M\"", def.Name)
+				}
+			default:
+				return fmt.Errorf("field %q must be a duration", def.Name)
+			}
+			values[def.Name] = secs
+		case "date", "datetime":
+			str, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("field %q must be a string", def.Name)
+			}
+			if strings.TrimSpace(str) == "" {
+				if def.Required {
+					return fmt.Errorf("field %q is required", def.Name)
+				}
+				delete(values, def.Name)
+				continue
+			}
+			if def.Type == "date" {
+				if _, err := time.Parse(time.DateOnly, str); err != nil {
+					return fmt.Errorf("field %q must be a date in YYYY-MM-DD format", def.Name)
+				}
+				continue
+			}
+			t, err := parseDatetimeValue(str)
+			if err != nil {
+				return fmt.Errorf("field %q must be an RFC 3339 timestamp with a time zone offset", def.Name)
+			}
+			values[def.Name] = formatDatetimeValue(t)
+		case "multiselect":
+			ids, err := normalizeMultiselectValue(def, v, previous[def.Name])
+			if err != nil {
+				return err
+			}
+			if def.Required && len(ids) == 0 {
+				return fmt.Errorf("field %q is required", def.Name)
+			}
+			values[def.Name] = ids
 		}
 	}
+	computeFieldValues(definitions, values)
 	return nil
 }
 
@@ -161,13 +411,17 @@ func handleCreateLog(pool *pgxpool.Pool) http.HandlerFunc {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		if err := validateExpectedInterval(req.ExpectedIntervalSeconds); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
 
 		var l logResponse
 		err := pool.QueryRow(r.Context(),
-			`INSERT INTO logs (user_id, name, fields) VALUES ($1, $2, $3)
-			 RETURNING id, name, fields, created_at, updated_at`,
-			user.ID, req.Name, req.Fields,
-		).Scan(&l.ID, &l.Name, &l.Fields, &l.CreatedAt, &l.UpdatedAt)
+			`INSERT INTO logs (user_id, name, fields, expected_interval_seconds) VALUES ($1, $2, $3, $4)
+			 RETURNING id, name, fields, expected_interval_seconds, created_at, updated_at`,
+			user.ID, req.Name, req.Fields, req.ExpectedIntervalSeconds,
+		).Scan(&l.ID, &l.Name, &l.Fields, &l.ExpectedIntervalSeconds, &l.CreatedAt, &l.UpdatedAt)
 
 		if err != nil {
 			var pgErr *pgconn.PgError
@@ -192,11 +446,14 @@ func handleListLogs(pool *pgxpool.Pool) http.HandlerFunc {
 		user := userFromContext(r.Context())
 
 		rows, err := pool.Query(r.Context(),
-			`SELECT id, name, fields, created_at, updated_at, is_owner FROM (
-				SELECT l.id, l.name, l.fields, l.created_at, l.updated_at, true AS is_owner
+			`SELECT id, name, fields, goal, expected_interval_seconds,
+				(SELECT max(le.occurred_at) FROM log_entries le WHERE le.log_id = combined.id),
+				created_at, updated_at, is_owner
+			FROM (
+				SELECT l.id, l.name, l.fields, l.goal, l.expected_interval_seconds, l.created_at, l.updated_at, true AS is_owner
 				FROM logs l WHERE l.user_id = $1
 				UNION ALL
-				SELECT l.id, l.name, l.fields, l.created_at, l.updated_at, false AS is_owner
+				SELECT l.id, l.name, l.fields, l.goal, l.expected_interval_seconds, l.created_at, l.updated_at, false AS is_owner
 				FROM logs l JOIN log_shares ls ON l.id = ls.log_id WHERE ls.user_id = $1
 			) combined ORDER BY lower(name)`,
 			user.ID,
@@ -207,18 +464,51 @@ func handleListLogs(pool *pgxpool.Pool) http.HandlerFunc {
 		}
 		defer rows.Close()
 
+		now := time.Now()
 		logs := []logResponse{}
 		for rows.Next() {
 			var l logResponse
-			if err := rows.Scan(&l.ID, &l.Name, &l.Fields, &l.CreatedAt, &l.UpdatedAt, &l.IsOwner); err != nil {
+			if err := rows.Scan(&l.ID, &l.Name, &l.Fields, &l.Goal, &l.ExpectedIntervalSeconds, &l.LastOccurredAt, &l.CreatedAt, &l.UpdatedAt, &l.IsOwner); err != nil {
 				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
 				return
 			}
 			if l.Fields == nil {
 				l.Fields = []fieldDefinition{}
 			}
+			setDueStatus(&l, now)
 			logs = append(logs, l)
 		}
+		if rows.Err() != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		rows.Close()
+
+		// Only logs with fields that use their last value need a query.
+		for i := range logs {
+			logs[i].Defaults, err = resolveFieldDefaults(r.Context(), pool, logs[i].ID, user.ID, logs[i].Fields)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+		}
+
+		var goalLogs []goalLog
+		var goalIndexes []int
+		for i, l := range logs {
+			if l.Goal != nil {
+				goalLogs = append(goalLogs, goalLog{LogID: l.ID, Goal: l.Goal, Fields: l.Fields})
+				goalIndexes = append(goalIndexes, i)
+			}
+		}
+		statuses, err := loadGoalStatuses(r.Context(), pool, goalLogs, now)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		for j, i := range goalIndexes {
+			logs[i].GoalStatus = statuses[j]
+		}
 
 		writeJSON(w, http.StatusOK, logs)
 	}
@@ -242,15 +532,19 @@ func handleGetLog(pool *pgxpool.Pool) http.HandlerFunc {
 		var l logResponse
 		var shareToken []byte
 		err = pool.QueryRow(r.Context(),
-			`SELECT id, name, fields, share_token, created_at, updated_at FROM logs WHERE id = $1`,
+			`SELECT id, name, fields, goal, expected_interval_seconds,
+				(SELECT max(le.occurred_at) FROM log_entries le WHERE le.log_id = logs.id),
+				share_token, created_at, updated_at
+			 FROM logs WHERE id = $1`,
 			logID,
-		).Scan(&l.ID, &l.Name, &l.Fields, &shareToken, &l.CreatedAt, &l.UpdatedAt)
+		).Scan(&l.ID, &l.Name, &l.Fields, &l.Goal, &l.ExpectedIntervalSeconds, &l.LastOccurredAt, &shareToken, &l.CreatedAt, &l.UpdatedAt)
 		if err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
 			return
 		}
 
 		l.IsOwner = access.IsOwner
+		setDueStatus(&l, time.Now())
 		if access.IsOwner && shareToken != nil {
 			tokenHex := hex.EncodeToString(shareToken)
 			l.ShareToken = &tokenHex
@@ -259,16 +553,39 @@ func handleGetLog(pool *pgxpool.Pool) http.HandlerFunc {
 		if l.Fields == nil {
 			l.Fields = []fieldDefinition{}
 		}
+		l.Defaults, err = resolveFieldDefaults(r.Context(), pool, logID, user.ID, l.Fields)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if l.Goal != nil {
+			l.GoalStatus, err = loadGoalStatus(r.Context(), pool, logID, l.Goal, l.Fields, time.Now())
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+		}
 		writeJSON(w, http.StatusOK, l)
 	}
 }
 
+// handleUpdateLog replaces a log's name, field definitions and expected
+// interval. Fields are matched to the current definitions by ID, or by name
+// when sent without one. Existing entries are migrated in the same
+// transaction: values of a renamed field move to the new name, values of a
+// deleted field are removed, and values of a field whose type changed are
+// converted. Computed fields are recomputed when they or the fields they refer
+// to change, and a goal on a field that is deleted or no longer numeric is
+// removed. Deleting a field that holds values requires confirm_delete, and
+// leaving out fields keeps the current definitions. With dry_run set nothing
+// is saved and the response lists those changes with the number of entries
+// each affects.
 func handleUpdateLog(pool *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := userFromContext(r.Context())
 		logID := chi.URLParam(r, "logID")
 
-		var req createLogRequest
+		var req updateLogRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 			return
@@ -280,28 +597,116 @@ func handleUpdateLog(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
-		if req.Fields == nil {
-			req.Fields = []fieldDefinition{}
+		if req.OnConversionError == "" {
+			req.OnConversionError = conversionAbort
 		}
-		if err := validateFieldDefinitions(req.Fields); err != nil {
+		if err := validateConversionMode(req.OnConversionError); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateExpectedInterval(req.ExpectedIntervalSeconds.Seconds); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
 
-		var l logResponse
-		var shareToken []byte
-		err := pool.QueryRow(r.Context(),
-			`UPDATE logs SET name = $1, fields = $2, updated_at = now()
-			 WHERE id = $3 AND user_id = $4
-			 RETURNING id, name, fields, share_token, created_at, updated_at`,
-			req.Name, req.Fields, logID, user.ID,
-		).Scan(&l.ID, &l.Name, &l.Fields, &shareToken, &l.CreatedAt, &l.UpdatedAt)
+		tx, err := pool.Begin(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer tx.Rollback(r.Context())
 
+		var previousFields []fieldDefinition
+		var goal *logGoal
+		err = tx.QueryRow(r.Context(),
+			`SELECT fields, goal FROM logs WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+			logID, user.ID,
+		).Scan(&previousFields, &goal)
 		if err != nil {
 			if errors.Is(err, pgx.ErrNoRows) {
 				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
 				return
 			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		// Leaving out fields keeps them as they are. Sending an empty list
+		// deletes them all.
+		if req.Fields == nil {
+			req.Fields = slices.Clone(previousFields)
+			if req.Fields == nil {
+				req.Fields = []fieldDefinition{}
+			}
+		}
+
+		assignFieldIDs(previousFields, req.Fields)
+		if err := reconcileSelectOptions(previousFields, req.Fields); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		renameExpressionFields(previousFields, req.Fields)
+		if err := validateFieldDefinitions(req.Fields); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		changes := planFieldMigration(previousFields, req.Fields)
+		if err := migrateEntryFields(r.Context(), tx, logID, changes, req.OnConversionError, req.ConfirmDelete, !req.DryRun); err != nil {
+			var convErr *fieldConversionError
+			var delErr *fieldDeletionError
+			if errors.As(err, &convErr) || errors.As(err, &delErr) {
+				writeJSON(w, http.StatusBadRequest, map[string]any{
+					"error":   err.Error(),
+					"changes": changes,
+				})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		if !req.DryRun && computedFieldsChanged(previousFields, req.Fields, changes) {
+			if err := recomputeEntryFields(r.Context(), tx, logID, req.Fields); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+		}
+
+		if req.DryRun {
+			if changes == nil {
+				changes = []*fieldChange{}
+			}
+			writeJSON(w, http.StatusOK, fieldMigrationPreview{DryRun: true, Changes: changes})
+			return
+		}
+
+		if goal != nil && goal.FieldID != "" && goalField(goal, req.Fields) == nil {
+			goal = nil
+		}
+
+		// Migrated or recomputed values may change the totals of the goal's
+		// cached periods.
+		if len(changes) > 0 || computedFieldsChanged(previousFields, req.Fields, changes) {
+			if _, err := tx.Exec(r.Context(), `DELETE FROM goal_streaks WHERE log_id = $1`, logID); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+		}
+
+		var l logResponse
+		var shareToken []byte
+		err = tx.QueryRow(r.Context(),
+			`UPDATE logs SET name = $1, fields = $2, goal = $3,
+				expected_interval_seconds = CASE WHEN $4 THEN $5 ELSE expected_interval_seconds END, updated_at = now()
+			 WHERE id = $6
+			 RETURNING id, name, fields, goal, expected_interval_seconds,
+				(SELECT max(le.occurred_at) FROM log_entries le WHERE le.log_id = logs.id),
+				share_token, created_at, updated_at`,
+			req.Name, req.Fields, goal, req.ExpectedIntervalSeconds.Set, req.ExpectedIntervalSeconds.Seconds, logID,
+		).Scan(&l.ID, &l.Name, &l.Fields, &l.Goal, &l.ExpectedIntervalSeconds, &l.LastOccurredAt, &shareToken, &l.CreatedAt, &l.UpdatedAt)
+
+		if err != nil {
 			var pgErr *pgconn.PgError
 			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
 				writeJSON(w, http.StatusConflict, map[string]string{"error": "a log with that name already exists"})
@@ -311,7 +716,13 @@ func handleUpdateLog(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		if err := tx.Commit(r.Context()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
 		l.IsOwner = true
+		setDueStatus(&l, time.Now())
 		if shareToken != nil {
 			tokenHex := hex.EncodeToString(shareToken)
 			l.ShareToken = &tokenHex
@@ -359,6 +770,18 @@ func handleCreateLogEntry(pool *pgxpool.Pool) http.HandlerFunc {
 		if req.Fields == nil {
 			req.Fields = map[string]any{}
 		}
+		if req.OccurredAt != nil {
+			if err := validateOccurredAt(*req.OccurredAt); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+
+		idempotencyKey := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+		if len(idempotencyKey) > 255 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "idempotency key must be at most 255 characters"})
+			return
+		}
 
 		access, err := checkLogAccess(r.Context(), pool, logID, user.ID)
 		if err != nil {
@@ -370,16 +793,59 @@ func handleCreateLogEntry(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		defaults, err := resolveFieldDefaults(r.Context(), pool, logID, user.ID, access.Fields)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		applyFieldDefaults(req.Fields, defaults)
+
 		if err := validateFieldValues(access.Fields, req.Fields); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
 
+		tx, err := pool.Begin(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer tx.Rollback(r.Context())
+
+		if idempotencyKey != "" {
+			previous, err := claimIdempotencyKey(r.Context(), tx, user.ID, idempotencyKey, logID)
+			if err != nil {
+				if errors.Is(err, errIdempotencyKeyReused) {
+					writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+					return
+				}
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+			if previous != nil {
+				w.Header().Set("Idempotent-Replayed", "true")
+				writeJSON(w, http.StatusCreated, previous)
+				return
+			}
+		}
+
+		if err := lockLogFields(r.Context(), tx, logID, access.Fields); err != nil {
+			switch {
+			case errors.Is(err, errLogFieldsChanged):
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			case errors.Is(err, pgx.ErrNoRows):
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+			default:
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			}
+			return
+		}
+
 		var entry logEntryResponse
-		err = pool.QueryRow(r.Context(),
-			`INSERT INTO log_entries (log_id, user_id, fields) VALUES ($1, $2, $3)
+		err = tx.QueryRow(r.Context(),
+			`INSERT INTO log_entries (log_id, user_id, fields, occurred_at) VALUES ($1, $2, $3, coalesce($4, now()))
 			 RETURNING id, log_id, user_id, fields, occurred_at, created_at, updated_at`,
-			logID, user.ID, req.Fields,
+			logID, user.ID, req.Fields, req.OccurredAt,
 		).Scan(&entry.ID, &entry.LogID, &entry.UserID, &entry.Fields, &entry.OccurredAt, &entry.CreatedAt, &entry.UpdatedAt)
 
 		if err != nil {
@@ -387,10 +853,29 @@ func handleCreateLogEntry(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		if err := clearGoalStreak(r.Context(), tx, logID, entry.OccurredAt); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
 		entry.Username = user.Username
 		if entry.Fields == nil {
 			entry.Fields = map[string]any{}
 		}
+		entry.FormattedFields = formatEntryFields(access.Fields, entry.Fields)
+
+		if idempotencyKey != "" {
+			if err := saveIdempotentResponse(r.Context(), tx, user.ID, idempotencyKey, entry); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+		}
+
+		if err := tx.Commit(r.Context()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
 		writeJSON(w, http.StatusCreated, entry)
 	}
 }
@@ -424,18 +909,62 @@ func handleUpdateLogEntry(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
-		if err := validateFieldValues(access.Fields, req.Fields); err != nil {
+		tx, err := pool.Begin(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer tx.Rollback(r.Context())
+
+		if err := lockLogFields(r.Context(), tx, logID, access.Fields); err != nil {
+			switch {
+			case errors.Is(err, errLogFieldsChanged):
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			case errors.Is(err, pgx.ErrNoRows):
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+			default:
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			}
+			return
+		}
+
+		var previousFields map[string]any
+		var previousOccurredAt time.Time
+		err = tx.QueryRow(r.Context(),
+			`SELECT fields, occurred_at FROM log_entries WHERE id = $1 AND log_id = $2`,
+			entryID, logID,
+		).Scan(&previousFields, &previousOccurredAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "entry not found"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		if err := validateUpdatedFieldValues(access.Fields, req.Fields, previousFields); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
 
+		// A value kept from a failed type conversion is replaced by any value
+		// now given for its field.
+		resolvedIDs := []string{}
+		for _, def := range access.Fields {
+			if _, ok := req.Fields[def.Name]; ok {
+				resolvedIDs = append(resolvedIDs, def.ID)
+			}
+		}
+
 		var entry logEntryResponse
-		err = pool.QueryRow(r.Context(),
-			`UPDATE log_entries SET fields = $1, occurred_at = $2, updated_at = now()
+		err = tx.QueryRow(r.Context(),
+			`UPDATE log_entries SET fields = $1, unconverted_fields = unconverted_fields - $5::text[], occurred_at = $2, updated_at = now()
 			 WHERE id = $3 AND log_id = $4
-			 RETURNING id, log_id, user_id, fields, occurred_at, created_at, updated_at`,
-			req.Fields, req.OccurredAt, entryID, logID,
-		).Scan(&entry.ID, &entry.LogID, &entry.UserID, &entry.Fields, &entry.OccurredAt, &entry.CreatedAt, &entry.UpdatedAt)
+			 RETURNING id, log_id, user_id, coalesce((SELECT username FROM users WHERE id = log_entries.user_id), deleted_username),
+				fields, unconverted_fields, occurred_at, created_at, updated_at`,
+			req.Fields, req.OccurredAt, entryID, logID, resolvedIDs,
+		).Scan(&entry.ID, &entry.LogID, &entry.UserID, &entry.Username, &entry.Fields, &entry.UnconvertedFields, &entry.OccurredAt, &entry.CreatedAt, &entry.UpdatedAt)
 
 		if err != nil {
 			if errors.Is(err, pgx.ErrNoRows) {
@@ -446,10 +975,16 @@ func handleUpdateLogEntry(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
-		err = pool.QueryRow(r.Context(),
-			`SELECT username FROM users WHERE id = $1`, entry.UserID,
-		).Scan(&entry.Username)
-		if err != nil {
+		// The entry may have moved out of a cached period as well as into one.
+		earliest := entry.OccurredAt
+		if previousOccurredAt.Before(earliest) {
+			earliest = previousOccurredAt
+		}
+		if err := clearGoalStreak(r.Context(), tx, logID, earliest); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if err := tx.Commit(r.Context()); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
 			return
 		}
@@ -457,6 +992,7 @@ func handleUpdateLogEntry(pool *pgxpool.Pool) http.HandlerFunc {
 		if entry.Fields == nil {
 			entry.Fields = map[string]any{}
 		}
+		entry.FormattedFields = formatEntryFields(access.Fields, entry.Fields)
 		writeJSON(w, http.StatusOK, entry)
 	}
 }
@@ -477,17 +1013,39 @@ func handleDeleteLogEntry(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
-		tag, err := pool.Exec(r.Context(),
-			`DELETE FROM log_entries WHERE id = $1 AND log_id = $2`,
-			entryID, logID,
-		)
+		tx, err := pool.Begin(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer tx.Rollback(r.Context())
+
+		// Entry writes share lock the log row; see loadGoalStatuses.
+		if _, err := tx.Exec(r.Context(), `SELECT 1 FROM logs WHERE id = $1 FOR SHARE`, logID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
 
+		var occurredAt time.Time
+		err = tx.QueryRow(r.Context(),
+			`DELETE FROM log_entries WHERE id = $1 AND log_id = $2 RETURNING occurred_at`,
+			entryID, logID,
+		).Scan(&occurredAt)
 		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "entry not found"})
+				return
+			}
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
 			return
 		}
-		if tag.RowsAffected() == 0 {
-			writeJSON(w, http.StatusNotFound, map[string]string{"error": "entry not found"})
+
+		if err := clearGoalStreak(r.Context(), tx, logID, occurredAt); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if err := tx.Commit(r.Context()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
 			return
 		}
 
@@ -495,12 +1053,56 @@ func handleDeleteLogEntry(pool *pgxpool.Pool) http.HandlerFunc {
 	}
 }
 
+const defaultEntryPageSize = 50
+const maxEntryPageSize = 200
+
+type logEntryPageResponse struct {
+	Entries    []logEntryResponse `json:"entries"`
+	NextCursor *string            `json:"next_cursor"`
+}
+
+// encodeEntryCursor returns an opaque cursor pointing just past the given
+// entry in (occurred_at DESC, id DESC) order.
+func encodeEntryCursor(occurredAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(occurredAt.UTC().Format(time.RFC3339Nano) + "," + id))
+}
+
+func decodeEntryCursor(cursor string) (time.Time, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	ts, id, ok := strings.Cut(string(b), ",")
+	if !ok {
+		return time.Time{}, "", fmt.Errorf("malformed cursor")
+	}
+	if _, err := uuid.FromString(id); err != nil {
+		return time.Time{}, "", err
+	}
+	occurredAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return occurredAt, id, nil
+}
+
 func handleListLogEntries(pool *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := userFromContext(r.Context())
 		logID := chi.URLParam(r, "logID")
+		query := r.URL.Query()
 
-		_, err := checkLogAccess(r.Context(), pool, logID, user.ID)
+		limit := defaultEntryPageSize
+		if s := query.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxEntryPageSize {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxEntryPageSize)})
+				return
+			}
+			limit = n
+		}
+
+		access, err := checkLogAccess(r.Context(), pool, logID, user.ID)
 		if err != nil {
 			if errors.Is(err, pgx.ErrNoRows) {
 				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
@@ -510,13 +1112,31 @@ func handleListLogEntries(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		q := newEntryQuery(logID)
+		if err := applyEntryFilters(q, query, access.Fields); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if s := query.Get("cursor"); s != "" {
+			occurredAt, id, err := decodeEntryCursor(s)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+				return
+			}
+			q.where("(le.occurred_at, le.id) < (" + q.arg(occurredAt) + ", " + q.arg(id) + ")")
+		}
+
+		// Fetch one extra row to learn whether another page exists.
+		limitArg := q.arg(limit + 1)
 		rows, err := pool.Query(r.Context(),
-			`SELECT le.id, le.log_id, le.user_id, u.username, le.fields, le.occurred_at, le.created_at, le.updated_at
+			`SELECT le.id, le.log_id, le.user_id, coalesce(u.username, le.deleted_username), le.fields, le.unconverted_fields, le.occurred_at, le.created_at, le.updated_at
 			 FROM log_entries le
-			 JOIN users u ON le.user_id = u.id
-			 WHERE le.log_id = $1
-			 ORDER BY le.occurred_at DESC`,
-			logID,
+			 LEFT JOIN users u ON le.user_id = u.id
+			 WHERE `+q.whereSQL()+`
+			 ORDER BY le.occurred_at DESC, le.id DESC
+			 LIMIT `+limitArg,
+			q.args...,
 		)
 		if err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
@@ -527,16 +1147,29 @@ func handleListLogEntries(pool *pgxpool.Pool) http.HandlerFunc {
 		entries := []logEntryResponse{}
 		for rows.Next() {
 			var e logEntryResponse
-			if err := rows.Scan(&e.ID, &e.LogID, &e.UserID, &e.Username, &e.Fields, &e.OccurredAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			if err := rows.Scan(&e.ID, &e.LogID, &e.UserID, &e.Username, &e.Fields, &e.UnconvertedFields, &e.OccurredAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
 				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
 				return
 			}
 			if e.Fields == nil {
 				e.Fields = map[string]any{}
 			}
+			e.FormattedFields = formatEntryFields(access.Fields, e.Fields)
 			entries = append(entries, e)
 		}
+		if rows.Err() != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		page := logEntryPageResponse{Entries: entries}
+		if len(entries) > limit {
+			page.Entries = entries[:limit]
+			last := page.Entries[limit-1]
+			cursor := encodeEntryCursor(last.OccurredAt, last.ID)
+			page.NextCursor = &cursor
+		}
 
-		writeJSON(w, http.StatusOK, entries)
+		writeJSON(w, http.StatusOK, page)
 	}
 }
@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	minExpectedIntervalSeconds = 60
+	maxExpectedIntervalSeconds = 366 * 24 * 60 * 60
+)
+
+// validateExpectedInterval checks how often entries are expected in a log.
+// nil means the log has no expected interval.
+func validateExpectedInterval(seconds *int) error {
+	if seconds == nil {
+		return nil
+	}
+	if *seconds < minExpectedIntervalSeconds || *seconds > maxExpectedIntervalSeconds {
+		return fmt.Errorf("expected_interval_seconds must be between %d and %d", minExpectedIntervalSeconds, maxExpectedIntervalSeconds)
+	}
+	return nil
+}
+
+// optionalInterval is an expected interval in a log update. It tells a
+// missing key, which keeps the log's interval, from null, which removes it.
+type optionalInterval struct {
+	Set     bool
+	Seconds *int
+}
+
+func (o *optionalInterval) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Seconds)
+}
+
+// setDueStatus sets when the next entry of l is due and whether it is overdue
+// at now. The next entry is due one expected interval after the latest entry.
+// A log without entries or an expected interval is never overdue.
+func setDueStatus(l *logResponse, now time.Time) {
+	l.NextDueAt = nil
+	l.Overdue = false
+	if l.ExpectedIntervalSeconds == nil || l.LastOccurredAt == nil {
+		return
+	}
+	due := l.LastOccurredAt.Add(time.Duration(*l.ExpectedIntervalSeconds) * time.Second)
+	l.NextDueAt = &due
+	l.Overdue = now.After(due)
+}
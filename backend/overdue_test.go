@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDueStatus(t *testing.T) {
+	now := time.Date(2025, 3, 9, 12, 0, 0, 0, time.UTC)
+	last := now.Add(-2 * time.Hour)
+
+	l := logResponse{LastOccurredAt: &last}
+	setDueStatus(&l, now)
+	assert.Nil(t, l.NextDueAt)
+	assert.False(t, l.Overdue)
+
+	l.ExpectedIntervalSeconds = ptr(3 * 60 * 60)
+	setDueStatus(&l, now)
+	require.NotNil(t, l.NextDueAt)
+	assert.Equal(t, now.Add(time.Hour), *l.NextDueAt)
+	assert.False(t, l.Overdue)
+
+	l.ExpectedIntervalSeconds = ptr(60 * 60)
+	setDueStatus(&l, now)
+	assert.Equal(t, now.Add(-time.Hour), *l.NextDueAt)
+	assert.True(t, l.Overdue)
+
+	// A log without entries is not due yet.
+	l.LastOccurredAt = nil
+	setDueStatus(&l, now)
+	assert.Nil(t, l.NextDueAt)
+	assert.False(t, l.Overdue)
+}
+
+func TestOptionalInterval(t *testing.T) {
+	var req updateLogRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "Stretch"}`), &req))
+	assert.False(t, req.ExpectedIntervalSeconds.Set)
+
+	req = updateLogRequest{}
+	require.NoError(t, json.Unmarshal([]byte(`{"expected_interval_seconds": null}`), &req))
+	assert.True(t, req.ExpectedIntervalSeconds.Set)
+	assert.Nil(t, req.ExpectedIntervalSeconds.Seconds)
+
+	req = updateLogRequest{}
+	require.NoError(t, json.Unmarshal([]byte(`{"expected_interval_seconds": 3600}`), &req))
+	assert.True(t, req.ExpectedIntervalSeconds.Set)
+	assert.Equal(t, ptr(3600), req.ExpectedIntervalSeconds.Seconds)
+}
+
+func TestListLogs_ExpectedInterval(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	resp, body := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Diapers", "expected_interval_seconds": 30}, cookies)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "expected_interval_seconds")
+
+	resp, diapers := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Diapers", "expected_interval_seconds": 3 * 60 * 60}, cookies)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, 10800.0, diapers["expected_interval_seconds"])
+	assert.Nil(t, diapers["last_occurred_at"])
+	assert.Equal(t, false, diapers["overdue"])
+	diapersID := diapers["id"].(string)
+
+	resp, stretch := postJSON(srv.URL+"/api/logs", map[string]any{"name": "Stretch", "expected_interval_seconds": 60 * 60}, cookies)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	stretchID := stretch["id"].(string)
+
+	last := time.Now().Add(-2 * time.Hour).UTC().Truncate(time.Second)
+	for _, logID := range []string{diapersID, stretchID} {
+		resp, _ := postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{"occurred_at": last.Add(-time.Hour)}, cookies)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		resp, _ = postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{"occurred_at": last}, cookies)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	resp, logs := getJSONArray(srv.URL+"/api/logs", cookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, logs, 2)
+
+	assert.Equal(t, last.Format(time.RFC3339), logs[0]["last_occurred_at"])
+	assert.Equal(t, last.Add(3*time.Hour).Format(time.RFC3339), logs[0]["next_due_at"])
+	assert.Equal(t, false, logs[0]["overdue"])
+
+	assert.Equal(t, last.Add(time.Hour).Format(time.RFC3339), logs[1]["next_due_at"])
+	assert.Equal(t, true, logs[1]["overdue"])
+
+	// Updating a log without the expected_interval_seconds key keeps it.
+	resp, updated := putJSON(srv.URL+"/api/logs/"+stretchID, map[string]any{"name": "Stretching"}, cookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3600.0, updated["expected_interval_seconds"])
+	assert.Equal(t, true, updated["overdue"])
+
+	// Setting it to null removes it.
+	resp, updated = putJSON(srv.URL+"/api/logs/"+stretchID, map[string]any{"name": "Stretch", "expected_interval_seconds": nil}, cookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, updated["expected_interval_seconds"])
+	assert.Nil(t, updated["next_due_at"])
+	assert.Equal(t, false, updated["overdue"])
+	assert.Equal(t, last.Format(time.RFC3339), updated["last_occurred_at"])
+}
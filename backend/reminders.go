@@ -0,0 +1,280 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reminderRule tells the reminder scheduler when to remind a user to add an
+// entry to a log. A rule either follows a cron Schedule or fires once
+// SinceLastEntrySeconds have passed since the latest entry in the log. No
+// reminders are sent between QuietStart and QuietEnd; a reminder that comes
+// due then is sent when the quiet hours end.
+type reminderRule struct {
+	ID                    string  `json:"id"`
+	LogID                 string  `json:"log_id"`
+	Schedule              *string `json:"schedule"`
+	SinceLastEntrySeconds *int    `json:"since_last_entry_seconds"`
+	// TZ is the IANA time zone that the schedule and quiet hours are in.
+	TZ string `json:"tz"`
+	// QuietStart and QuietEnd are local times such as "22:00" and "07:00".
+	QuietStart *string   `json:"quiet_start"`
+	QuietEnd   *string   `json:"quiet_end"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// validateReminderRule checks rule and normalizes its schedule, time zone and
+// quiet hours.
+func validateReminderRule(rule *reminderRule) error {
+	if (rule.Schedule == nil) == (rule.SinceLastEntrySeconds == nil) {
+		return fmt.Errorf("exactly one of schedule and since_last_entry_seconds must be set")
+	}
+	if rule.Schedule != nil {
+		schedule := strings.Join(strings.Fields(*rule.Schedule), " ")
+		if _, err := parseCronSchedule(schedule); err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+		rule.Schedule = &schedule
+	}
+	if rule.SinceLastEntrySeconds != nil {
+		if s := *rule.SinceLastEntrySeconds; s < minExpectedIntervalSeconds || s > maxExpectedIntervalSeconds {
+			return fmt.Errorf("since_last_entry_seconds must be between %d and %d", minExpectedIntervalSeconds, maxExpectedIntervalSeconds)
+		}
+	}
+
+	if rule.TZ == "" {
+		rule.TZ = "UTC"
+	}
+	if _, err := loadTimeZone(rule.TZ); err != nil {
+		return err
+	}
+
+	if (rule.QuietStart == nil) != (rule.QuietEnd == nil) {
+		return fmt.Errorf("quiet_start and quiet_end must be set together")
+	}
+	for _, p := range []*string{rule.QuietStart, rule.QuietEnd} {
+		if p == nil {
+			continue
+		}
+		t, err := time.Parse("15:04", strings.TrimSpace(*p))
+		if err != nil {
+			return fmt.Errorf("quiet hours must be times such as 22:00")
+		}
+		*p = t.Format("15:04")
+	}
+	return nil
+}
+
+// inQuietHours reports whether the wall clock time of t is within the quiet
+// hours of rule. Quiet hours that end before they start span midnight.
+func inQuietHours(rule *reminderRule, t time.Time) bool {
+	if rule.QuietStart == nil || rule.QuietEnd == nil {
+		return false
+	}
+	start, err1 := time.Parse("15:04", *rule.QuietStart)
+	end, err2 := time.Parse("15:04", *rule.QuietEnd)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	m := t.Hour()*60 + t.Minute()
+	s := start.Hour()*60 + start.Minute()
+	e := end.Hour()*60 + end.Minute()
+	if s <= e {
+		return m >= s && m < e
+	}
+	return m >= s || m < e
+}
+
+// maxReminderCatchUp limits how far back the scheduler looks for a missed
+// scheduled reminder, such as after the server was down.
+const maxReminderCatchUp = 24 * time.Hour
+
+// reminderDueAt returns the time at which rule came due if a reminder should
+// be sent at now, or the zero time if not. lastDue is when the last reminder
+// sent for the rule came due and lastEntry is the time of the latest entry in
+// the log; either is zero if there is none.
+//
+// A scheduled rule is due at its latest occurrence since lastDue, and a rule
+// on the time since the last entry is due that long after the latest entry, or
+// after the rule was created if the log has no entries. Either way a reminder
+// is not sent during quiet hours or if an entry was added since it came due.
+func reminderDueAt(rule *reminderRule, lastDue, lastEntry, now time.Time) time.Time {
+	loc, err := time.LoadLocation(rule.TZ)
+	if err != nil {
+		return time.Time{}
+	}
+	if inQuietHours(rule, now.In(loc)) {
+		return time.Time{}
+	}
+
+	var due time.Time
+	if rule.Schedule != nil {
+		schedule, err := parseCronSchedule(*rule.Schedule)
+		if err != nil {
+			return time.Time{}
+		}
+		start := rule.CreatedAt
+		if lastDue.After(start) {
+			start = lastDue
+		}
+		if earliest := now.Add(-maxReminderCatchUp); earliest.After(start) {
+			start = earliest
+		}
+		for t := schedule.next(start.In(loc)); !t.IsZero() && !t.After(now); t = schedule.next(t) {
+			due = t
+		}
+	} else {
+		base := lastEntry
+		if base.IsZero() {
+			base = rule.CreatedAt
+		}
+		due = base.Add(time.Duration(*rule.SinceLastEntrySeconds) * time.Second)
+		if due.After(now) {
+			return time.Time{}
+		}
+	}
+
+	if due.IsZero() || !due.After(lastDue) || !lastEntry.Before(due) {
+		return time.Time{}
+	}
+	return due
+}
+
+type createReminderRuleRequest struct {
+	Schedule              *string `json:"schedule"`
+	SinceLastEntrySeconds *int    `json:"since_last_entry_seconds"`
+	TZ                    string  `json:"tz"`
+	QuietStart            *string `json:"quiet_start"`
+	QuietEnd              *string `json:"quiet_end"`
+}
+
+// handleListReminderRules lists the requesting user's reminder rules for a
+// log.
+func handleListReminderRules(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		logID := chi.URLParam(r, "logID")
+
+		if _, err := checkLogAccess(r.Context(), pool, logID, user.ID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		rows, err := pool.Query(r.Context(),
+			`SELECT id, log_id, schedule, since_last_entry_seconds, tz, quiet_start, quiet_end, created_at
+			 FROM reminder_rules
+			 WHERE log_id = $1 AND user_id = $2
+			 ORDER BY created_at, id`,
+			logID, user.ID,
+		)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		defer rows.Close()
+
+		rules := []reminderRule{}
+		for rows.Next() {
+			var rule reminderRule
+			if err := rows.Scan(&rule.ID, &rule.LogID, &rule.Schedule, &rule.SinceLastEntrySeconds, &rule.TZ, &rule.QuietStart, &rule.QuietEnd, &rule.CreatedAt); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+			rules = append(rules, rule)
+		}
+		if rows.Err() != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, rules)
+	}
+}
+
+// handleCreateReminderRule adds a reminder rule for the requesting user to a
+// log they own or that is shared with them.
+func handleCreateReminderRule(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		logID := chi.URLParam(r, "logID")
+
+		if _, err := checkLogAccess(r.Context(), pool, logID, user.ID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		var req createReminderRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+
+		rule := reminderRule{
+			LogID:                 logID,
+			Schedule:              req.Schedule,
+			SinceLastEntrySeconds: req.SinceLastEntrySeconds,
+			TZ:                    req.TZ,
+			QuietStart:            req.QuietStart,
+			QuietEnd:              req.QuietEnd,
+		}
+		if err := validateReminderRule(&rule); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		err := pool.QueryRow(r.Context(),
+			`INSERT INTO reminder_rules (log_id, user_id, schedule, since_last_entry_seconds, tz, quiet_start, quiet_end)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)
+			 RETURNING id, created_at`,
+			logID, user.ID, rule.Schedule, rule.SinceLastEntrySeconds, rule.TZ, rule.QuietStart, rule.QuietEnd,
+		).Scan(&rule.ID, &rule.CreatedAt)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, rule)
+	}
+}
+
+// handleDeleteReminderRule removes one of the requesting user's reminder
+// rules.
+func handleDeleteReminderRule(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		logID := chi.URLParam(r, "logID")
+		reminderID := chi.URLParam(r, "reminderID")
+
+		tag, err := pool.Exec(r.Context(),
+			`DELETE FROM reminder_rules WHERE id = $1 AND log_id = $2 AND user_id = $3`,
+			reminderID, logID, user.ID,
+		)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "reminder not found"})
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,244 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reminder is a reminder to add an entry to a log, as sent to a notifier.
+type reminder struct {
+	RuleID   string    `json:"rule_id"`
+	LogID    string    `json:"log_id"`
+	LogName  string    `json:"log_name"`
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	Email    *string   `json:"email"`
+	DueAt    time.Time `json:"due_at"`
+	Message  string    `json:"message"`
+}
+
+// notifier delivers reminders to users. An error means the reminder was not
+// delivered and the scheduler should try again later.
+type notifier interface {
+	Notify(ctx context.Context, r reminder) error
+}
+
+// logNotifier writes reminders to the server log. It is used when no other
+// notifier is configured.
+type logNotifier struct{}
+
+func (logNotifier) Notify(ctx context.Context, r reminder) error {
+	log.Printf("Reminder for %s: %s", r.Username, r.Message)
+	return nil
+}
+
+// webhookNotifier posts each reminder as JSON to a URL, such as a service that
+// sends push notifications or email.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, r reminder) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("reminder webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newNotifier returns the notifier configured by cfg.
+func newNotifier(cfg Config) notifier {
+	if cfg.ReminderWebhookURL != "" {
+		return &webhookNotifier{url: cfg.ReminderWebhookURL, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return logNotifier{}
+}
+
+// reminderScheduler periodically evaluates every reminder rule and sends the
+// reminders that are due.
+//
+// Each rule is evaluated in its own transaction that locks the rule with SKIP
+// LOCKED, so several server instances can run schedulers against the same
+// database without evaluating a rule at the same time. A reminder is recorded
+// in reminder_deliveries, keyed by rule and due time, and committed before the
+// notifier is called, so no lock is held while a slow notifier runs and a
+// reminder is sent once even across restarts. If the notifier fails, the
+// record is deleted and the reminder is retried on the next tick. Only a crash
+// between committing and delivering a reminder can lose it.
+type reminderScheduler struct {
+	pool     *pgxpool.Pool
+	notifier notifier
+	interval time.Duration
+}
+
+// run evaluates the reminder rules every interval until ctx is canceled.
+func (s *reminderScheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.tick(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("Reminder scheduler: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick evaluates every reminder rule at now and sends the reminders that are
+// due.
+func (s *reminderScheduler) tick(ctx context.Context, now time.Time) error {
+	rows, err := s.pool.Query(ctx, `SELECT id FROM reminder_rules ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	var ruleIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ruleIDs = append(ruleIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, id := range ruleIDs {
+		if err := s.processRule(ctx, id, now); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// processRule sends the reminder for the rule ruleID if one is due at now. It
+// does nothing if another scheduler is evaluating the rule or if the rule's
+// user no longer has access to its log.
+func (s *reminderScheduler) processRule(ctx context.Context, ruleID string, now time.Time) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var rule reminderRule
+	var rem reminder
+	var lastDue, lastEntry *time.Time
+	err = tx.QueryRow(ctx,
+		`SELECT r.id, r.log_id, r.schedule, r.since_last_entry_seconds, r.tz, r.quiet_start, r.quiet_end, r.created_at,
+			l.name, u.id, u.username, u.email,
+			(SELECT max(d.due_at) FROM reminder_deliveries d WHERE d.rule_id = r.id),
+			(SELECT max(le.occurred_at) FROM log_entries le WHERE le.log_id = r.log_id)
+		 FROM reminder_rules r
+		 JOIN logs l ON l.id = r.log_id
+		 JOIN users u ON u.id = r.user_id
+		 WHERE r.id = $1
+			AND (l.user_id = r.user_id OR EXISTS (SELECT 1 FROM log_shares ls WHERE ls.log_id = r.log_id AND ls.user_id = r.user_id))
+		 FOR UPDATE OF r SKIP LOCKED`,
+		ruleID,
+	).Scan(&rule.ID, &rule.LogID, &rule.Schedule, &rule.SinceLastEntrySeconds, &rule.TZ, &rule.QuietStart, &rule.QuietEnd, &rule.CreatedAt,
+		&rem.LogName, &rem.UserID, &rem.Username, &rem.Email, &lastDue, &lastEntry)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	var lastDueAt, lastEntryAt time.Time
+	if lastDue != nil {
+		lastDueAt = *lastDue
+	}
+	if lastEntry != nil {
+		lastEntryAt = *lastEntry
+	}
+	due := reminderDueAt(&rule, lastDueAt, lastEntryAt, now)
+	if due.IsZero() {
+		return nil
+	}
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO reminder_deliveries (rule_id, due_at) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		rule.ID, due,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	rem.RuleID = rule.ID
+	rem.LogID = rule.LogID
+	rem.DueAt = due
+	rem.Message = reminderMessage(&rule, rem.LogName, lastEntry, now)
+	if err := s.notifier.Notify(ctx, rem); err != nil {
+		// Forget the delivery so the next tick tries again, even if the
+		// notifier failed because ctx was canceled.
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if _, deleteErr := s.pool.Exec(cleanupCtx,
+			`DELETE FROM reminder_deliveries WHERE rule_id = $1 AND due_at = $2`,
+			rule.ID, due,
+		); deleteErr != nil {
+			return errors.Join(err, deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// reminderMessage describes the reminder for rule to the user.
+func reminderMessage(rule *reminderRule, logName string, lastEntry *time.Time, now time.Time) string {
+	if rule.SinceLastEntrySeconds != nil && lastEntry != nil {
+		return fmt.Sprintf("It has been %s since the last %s entry.", formatElapsed(now.Sub(*lastEntry)), logName)
+	}
+	return fmt.Sprintf("Time to log %s.", logName)
+}
+
+// formatElapsed formats d in whole hours and minutes, such as "3h 5m".
+func formatElapsed(d time.Duration) string {
+	d = d.Round(time.Minute)
+	h := int(d / time.Hour)
+	m := int((d % time.Hour) / time.Minute)
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	}
+	return fmt.Sprintf("%dh %dm", h, m)
+}
@@ -2,9 +2,14 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -29,33 +34,24 @@ func init() {
 }
 
 func runServer(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	// ctx is canceled when the server is asked to stop.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	var cfg Config
-	if configFile != "" {
-		var err error
-		cfg, err = LoadConfigFile(configFile)
-		if err != nil {
-			return fmt.Errorf("unable to load config: %w", err)
-		}
-	} else {
-		cfg = DefaultConfig()
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		return err
 	}
 
 	if cmd.Flags().Changed("allow-registration") {
 		cfg.AllowRegistration = allowRegistration
 	}
 
-	pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	pool, err := connectDatabase(ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("unable to connect to database: %w", err)
+		return err
 	}
 	defer pool.Close()
-
-	err = pool.QueryRow(ctx, "select 1").Scan(new(int))
-	if err != nil {
-		return fmt.Errorf("unable to query database: %w", err)
-	}
 	log.Printf("Database connected")
 
 	var wan *webauthn.WebAuthn
@@ -91,12 +87,16 @@ func runServer(cmd *cobra.Command, args []string) error {
 		r.Get("/api/me", handleMe)
 		r.Put("/api/me/email", handleChangeEmail(pool))
 		r.Put("/api/me/password", handleChangePassword(pool))
+		r.Delete("/api/me", handleDeleteAccount(pool, wan))
+		r.Get("/api/me/export", handleExportAccount(pool))
+		r.Post("/api/me/import", handleImportAccount(pool))
 		if wan != nil {
 			r.Get("/api/me/passkeys", handleListPasskeys(pool))
 			r.Put("/api/me/passkeys/{passkeyID}", handleUpdatePasskey(pool))
 			r.Delete("/api/me/passkeys/{passkeyID}", handleDeletePasskey(pool))
 			r.Post("/api/me/passkeys/register/begin", handlePasskeyRegisterBegin(pool, wan))
 			r.Post("/api/me/passkeys/register/finish", handlePasskeyRegisterFinish(pool, wan))
+			r.Post("/api/me/passkeys/reauth/begin", handleReauthPasskeyBegin(pool, wan))
 		}
 
 		// Logs
@@ -105,12 +105,24 @@ func runServer(cmd *cobra.Command, args []string) error {
 		r.Get("/api/logs/{logID}", handleGetLog(pool))
 		r.Put("/api/logs/{logID}", handleUpdateLog(pool))
 		r.Delete("/api/logs/{logID}", handleDeleteLog(pool))
+		r.Put("/api/logs/{logID}/goal", handleSetLogGoal(pool))
+		r.Delete("/api/logs/{logID}/goal", handleDeleteLogGoal(pool))
 
 		// Log entries
 		r.Post("/api/logs/{logID}/entries", handleCreateLogEntry(pool))
 		r.Get("/api/logs/{logID}/entries", handleListLogEntries(pool))
+		r.Get("/api/logs/{logID}/entries.csv", handleExportLogEntriesCSV(pool))
+		r.Get("/api/logs/{logID}/stats", handleGetLogStats(pool))
+		r.Get("/api/logs/{logID}/buckets", handleListEntryBuckets(pool))
+		r.Post("/api/logs/{logID}/import", handleImportLogEntriesCSV(pool))
 		r.Put("/api/logs/{logID}/entries/{entryID}", handleUpdateLogEntry(pool))
 		r.Delete("/api/logs/{logID}/entries/{entryID}", handleDeleteLogEntry(pool))
+		r.Post("/api/entries/batch", handleBatchCreateLogEntries(pool))
+
+		// Reminders
+		r.Get("/api/logs/{logID}/reminders", handleListReminderRules(pool))
+		r.Post("/api/logs/{logID}/reminders", handleCreateReminderRule(pool))
+		r.Delete("/api/logs/{logID}/reminders/{reminderID}", handleDeleteReminderRule(pool))
 
 		// Sharing
 		r.Post("/api/logs/{logID}/share-token", handleCreateShareToken(pool))
@@ -121,8 +133,65 @@ func runServer(cmd *cobra.Command, args []string) error {
 		r.Post("/api/join/{token}", handleJoinLog(pool))
 	})
 
+	scheduler := &reminderScheduler{pool: pool, notifier: newNotifier(cfg), interval: time.Minute}
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		scheduler.run(ctx)
+	}()
+
+	server := &http.Server{Addr: cfg.ListenAddress, Handler: r}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server shutdown: %v", err)
+		}
+	}()
+
 	log.Printf("Starting server on %s (registration: %v)", cfg.ListenAddress, cfg.AllowRegistration)
-	return http.ListenAndServe(cfg.ListenAddress, r)
+	err = server.ListenAndServe()
+
+	// Let in-flight requests and the scheduler's current rule finish before
+	// the pool is closed.
+	stop()
+	<-shutdownDone
+	<-schedulerDone
+	if errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Server stopped")
+		return nil
+	}
+	return err
+}
+
+// loadConfig loads the configuration file at path, or the defaults if path is
+// empty.
+func loadConfig(path string) (Config, error) {
+	if path == "" {
+		return DefaultConfig(), nil
+	}
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to load config: %w", err)
+	}
+	return cfg, nil
+}
+
+func connectDatabase(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+
+	err = pool.QueryRow(ctx, "select 1").Scan(new(int))
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("unable to query database: %w", err)
+	}
+	return pool, nil
 }
 
 func handleSettings(cfg Config) http.HandlerFunc {
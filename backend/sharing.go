@@ -16,6 +16,7 @@ import (
 
 type logAccess struct {
 	LogID   string
+	Name    string
 	OwnerID string
 	IsOwner bool
 	Fields  []fieldDefinition
@@ -24,18 +25,18 @@ type logAccess struct {
 // checkLogAccess returns access info if the user owns the log or has shared access.
 // Returns pgx.ErrNoRows if the log doesn't exist or user has no access.
 func checkLogAccess(ctx context.Context, pool *pgxpool.Pool, logID, userID string) (*logAccess, error) {
-	var ownerID string
+	var name, ownerID string
 	var fields []fieldDefinition
 	err := pool.QueryRow(ctx,
-		`SELECT user_id, fields FROM logs WHERE id = $1`,
+		`SELECT name, user_id, fields FROM logs WHERE id = $1`,
 		logID,
-	).Scan(&ownerID, &fields)
+	).Scan(&name, &ownerID, &fields)
 	if err != nil {
 		return nil, err
 	}
 
 	if ownerID == userID {
-		return &logAccess{LogID: logID, OwnerID: ownerID, IsOwner: true, Fields: fields}, nil
+		return &logAccess{LogID: logID, Name: name, OwnerID: ownerID, IsOwner: true, Fields: fields}, nil
 	}
 
 	var exists bool
@@ -50,7 +51,7 @@ func checkLogAccess(ctx context.Context, pool *pgxpool.Pool, logID, userID strin
 		return nil, pgx.ErrNoRows
 	}
 
-	return &logAccess{LogID: logID, OwnerID: ownerID, IsOwner: false, Fields: fields}, nil
+	return &logAccess{LogID: logID, Name: name, OwnerID: ownerID, IsOwner: false, Fields: fields}, nil
 }
 
 type shareTokenResponse struct {
@@ -0,0 +1,164 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type logStatsResponse struct {
+	Count           int        `json:"count"`
+	FirstOccurredAt *time.Time `json:"first_occurred_at"`
+	LastOccurredAt  *time.Time `json:"last_occurred_at"`
+	// SecondsSinceLast is the time from the last entry to now.
+	SecondsSinceLast *float64 `json:"seconds_since_last"`
+	// MeanGapSeconds and MedianGapSeconds describe the time between
+	// consecutive entries.
+	MeanGapSeconds   *float64     `json:"mean_gap_seconds"`
+	MedianGapSeconds *float64     `json:"median_gap_seconds"`
+	Fields           []fieldStats `json:"fields"`
+}
+
+// fieldStats summarizes the values of a number, duration or computed field.
+// Durations are in seconds.
+type fieldStats struct {
+	Name  string   `json:"name"`
+	Type  string   `json:"type"`
+	Count int      `json:"count"`
+	Sum   *float64 `json:"sum"`
+	Min   *float64 `json:"min"`
+	Max   *float64 `json:"max"`
+	Mean  *float64 `json:"mean"`
+	// Percentiles maps names such as "p50" to the value at that percentile.
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+var defaultStatsPercentiles = []float64{25, 50, 75, 90}
+
+const maxStatsPercentiles = 10
+
+// parsePercentiles parses a comma separated list of percentiles between 0 and
+// 100.
+func parsePercentiles(s string) ([]float64, error) {
+	if s == "" {
+		return defaultStatsPercentiles, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) > maxStatsPercentiles {
+		return nil, fmt.Errorf("too many percentiles (max %d)", maxStatsPercentiles)
+	}
+	percentiles := make([]float64, len(parts))
+	for i, part := range parts {
+		p, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("percentiles must be numbers from 0 to 100")
+		}
+		percentiles[i] = p
+	}
+	return percentiles, nil
+}
+
+// handleGetLogStats summarizes a log's entries: how many there are, when the
+// first and last occurred, and the typical time between them, plus the count,
+// sum, min, max, mean and percentiles of each number, duration and computed
+// field. It accepts the same filters as handleListLogEntries, so from and to
+// set the window the statistics cover. percentiles is a comma separated list
+// of the percentiles to report (default 25,50,75,90).
+func handleGetLogStats(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		logID := chi.URLParam(r, "logID")
+		query := r.URL.Query()
+
+		access, err := checkLogAccess(r.Context(), pool, logID, user.ID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "log not found"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+
+		percentiles, err := parsePercentiles(query.Get("percentiles"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		q := newEntryQuery(logID)
+		if err := applyEntryFilters(q, query, access.Fields); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		var stats logStatsResponse
+		err = pool.QueryRow(r.Context(),
+			`SELECT count(*), min(occurred_at), max(occurred_at),
+				avg(gap), percentile_cont(0.5) WITHIN GROUP (ORDER BY gap)
+			 FROM (
+				SELECT le.occurred_at,
+					extract(epoch FROM le.occurred_at - lag(le.occurred_at) OVER (ORDER BY le.occurred_at, le.id))::float8 AS gap
+				FROM log_entries le
+				LEFT JOIN users u ON le.user_id = u.id
+				WHERE `+q.whereSQL()+`
+			 ) e`,
+			q.args...,
+		).Scan(&stats.Count, &stats.FirstOccurredAt, &stats.LastOccurredAt, &stats.MeanGapSeconds, &stats.MedianGapSeconds)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if stats.LastOccurredAt != nil {
+			since := time.Since(*stats.LastOccurredAt).Seconds()
+			stats.SecondsSinceLast = &since
+		}
+
+		fractions := make([]float64, len(percentiles))
+		for i, p := range percentiles {
+			fractions[i] = p / 100
+		}
+
+		stats.Fields = []fieldStats{}
+		for _, def := range access.Fields {
+			if def.Type != "number" && def.Type != "duration" && def.Type != "computed" {
+				continue
+			}
+
+			fs := fieldStats{Name: def.Name, Type: def.Type, Percentiles: map[string]float64{}}
+			fq := q.clone()
+			value := numericFieldSQL(fq.arg(def.Name)+"::text") + "::float8"
+			fractionsArg := fq.arg(fractions)
+			var values []float64
+			err := pool.QueryRow(r.Context(),
+				`SELECT count(v), sum(v), min(v), max(v), avg(v),
+					percentile_cont(`+fractionsArg+`::float8[]) WITHIN GROUP (ORDER BY v)
+				 FROM (
+					SELECT `+value+` AS v
+					FROM log_entries le
+					LEFT JOIN users u ON le.user_id = u.id
+					WHERE `+fq.whereSQL()+`
+				 ) e
+				 WHERE v IS NOT NULL`,
+				fq.args...,
+			).Scan(&fs.Count, &fs.Sum, &fs.Min, &fs.Max, &fs.Mean, &values)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+				return
+			}
+			for i, v := range values {
+				fs.Percentiles["p"+formatNumber(percentiles[i])] = v
+			}
+			stats.Fields = append(stats.Fields, fs)
+		}
+
+		writeJSON(w, http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePercentiles(t *testing.T) {
+	p, err := parsePercentiles("")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{25, 50, 75, 90}, p)
+
+	p, err = parsePercentiles("50, 99.9")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{50, 99.9}, p)
+
+	for _, bad := range []string{"x", "101", "-1", "1,2,3,4,5,6,7,8,9,10,11"} {
+		_, err := parsePercentiles(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestGetLogStats(t *testing.T) {
+	srv := setupTestRouter(t)
+	defer srv.Close()
+
+	cookies := registerUser(t, srv.URL, "alice")
+
+	_, created := postJSON(srv.URL+"/api/logs", map[string]any{
+		"name": "Pushups",
+		"fields": []map[string]any{
+			{"name": "reps", "type": "number"},
+			{"name": "notes", "type": "text"},
+		},
+	}, cookies)
+	logID := created["id"].(string)
+
+	resp, stats := getJSON(srv.URL+"/api/logs/"+logID+"/stats", cookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 0.0, stats["count"])
+	assert.Nil(t, stats["last_occurred_at"])
+	assert.Nil(t, stats["seconds_since_last"])
+
+	for _, e := range []struct{ occurredAt, reps string }{
+		{"2025-06-01T08:00:00Z", "10"},
+		{"2025-06-02T08:00:00Z", "20"},
+		{"2025-06-04T08:00:00Z", "30"},
+		{"2025-06-05T08:00:00Z", "40"},
+		{"2025-06-06T08:00:00Z", ""},
+	} {
+		resp, _ := postJSON(srv.URL+"/api/logs/"+logID+"/entries", map[string]any{
+			"fields":      map[string]any{"reps": e.reps},
+			"occurred_at": e.occurredAt,
+		}, cookies)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	resp, stats = getJSON(srv.URL+"/api/logs/"+logID+"/stats?percentiles=50,90", cookies)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 5.0, stats["count"])
+	assert.Equal(t, "2025-06-01T08:00:00Z", stats["first_occurred_at"])
+	assert.Equal(t, "2025-06-06T08:00:00Z", stats["last_occurred_at"])
+	assert.Greater(t, stats["seconds_since_last"], 0.0)
+	// Gaps of 1, 2, 1 and 1 days.
+	assert.Equal(t, 1.25*86400, stats["mean_gap_seconds"])
+	assert.Equal(t, 86400.0, stats["median_gap_seconds"])
+
+	fields := stats["fields"].([]any)
+	require.Len(t, fields, 1)
+	reps := fields[0].(map[string]any)
+	assert.Equal(t, "reps", reps["name"])
+	assert.Equal(t, 4.0, reps["count"])
+	assert.Equal(t, 100.0, reps["sum"])
+	assert.Equal(t, 10.0, reps["min"])
+	assert.Equal(t, 40.0, reps["max"])
+	assert.Equal(t, 25.0, reps["mean"])
+	assert.Equal(t, map[string]any{"p50": 25.0, "p90": 37.0}, reps["percentiles"])
+
+	// The window limits the entries summarized.
+	_, stats = getJSON(srv.URL+"/api/logs/"+logID+"/stats?from=2025-06-02&to=2025-06-04", cookies)
+	assert.Equal(t, 2.0, stats["count"])
+	reps = stats["fields"].([]any)[0].(map[string]any)
+	assert.Equal(t, 50.0, reps["sum"])
+
+	resp, _ = getJSON(srv.URL+"/api/logs/"+logID+"/stats?percentiles=200", cookies)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
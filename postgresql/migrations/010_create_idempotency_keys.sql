@@ -0,0 +1,17 @@
+CREATE TABLE idempotency_keys (
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key varchar(255) NOT NULL,
+    log_id uuid NOT NULL REFERENCES logs(id) ON DELETE CASCADE,
+    response jsonb,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL DEFAULT (now() + interval '24 hours'),
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON idempotency_keys TO {{.app_user}};
+
+---- create above / drop below ----
+
+DROP TABLE idempotency_keys;
@@ -0,0 +1,13 @@
+UPDATE logs SET fields = (
+    SELECT jsonb_agg(f || jsonb_build_object('id', substr(md5(random()::text), 1, 8)) ORDER BY ord)
+    FROM jsonb_array_elements(logs.fields) WITH ORDINALITY AS e(f, ord)
+)
+WHERE jsonb_array_length(fields) > 0;
+
+---- create above / drop below ----
+
+UPDATE logs SET fields = (
+    SELECT jsonb_agg(f - 'id' ORDER BY ord)
+    FROM jsonb_array_elements(logs.fields) WITH ORDINALITY AS e(f, ord)
+)
+WHERE jsonb_array_length(fields) > 0;
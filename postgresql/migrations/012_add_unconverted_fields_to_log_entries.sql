@@ -0,0 +1,7 @@
+-- Values that could not be converted when a field's type changed, keyed by
+-- field ID.
+ALTER TABLE log_entries ADD COLUMN unconverted_fields jsonb NOT NULL DEFAULT '{}';
+
+---- create above / drop below ----
+
+ALTER TABLE log_entries DROP COLUMN unconverted_fields;
@@ -0,0 +1,5 @@
+ALTER TABLE logs ADD COLUMN goal jsonb;
+
+---- create above / drop below ----
+
+ALTER TABLE logs DROP COLUMN goal;
@@ -0,0 +1,5 @@
+ALTER TABLE logs ADD COLUMN expected_interval_seconds integer CHECK (expected_interval_seconds > 0);
+
+---- create above / drop below ----
+
+ALTER TABLE logs DROP COLUMN expected_interval_seconds;
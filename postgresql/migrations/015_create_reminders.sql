@@ -0,0 +1,30 @@
+CREATE TABLE reminder_rules (
+    id uuid PRIMARY KEY DEFAULT uuidv7(),
+    log_id uuid NOT NULL REFERENCES logs(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    schedule text,
+    since_last_entry_seconds integer CHECK (since_last_entry_seconds > 0),
+    tz text NOT NULL,
+    quiet_start text,
+    quiet_end text,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CHECK ((schedule IS NULL) <> (since_last_entry_seconds IS NULL))
+);
+
+CREATE INDEX reminder_rules_log_id_user_id_idx ON reminder_rules (log_id, user_id);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON reminder_rules TO {{.app_user}};
+
+CREATE TABLE reminder_deliveries (
+    rule_id uuid NOT NULL REFERENCES reminder_rules(id) ON DELETE CASCADE,
+    due_at timestamptz NOT NULL,
+    sent_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (rule_id, due_at)
+);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON reminder_deliveries TO {{.app_user}};
+
+---- create above / drop below ----
+
+DROP TABLE reminder_deliveries;
+DROP TABLE reminder_rules;
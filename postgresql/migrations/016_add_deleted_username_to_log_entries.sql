@@ -0,0 +1,14 @@
+-- Entries kept after their author's account was deleted, such as those in a
+-- log transferred to another member, have no user_id and record the author's
+-- username instead.
+ALTER TABLE log_entries ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE log_entries ADD COLUMN deleted_username text;
+ALTER TABLE log_entries ADD CONSTRAINT log_entries_author_check CHECK ((user_id IS NULL) = (deleted_username IS NOT NULL));
+
+---- create above / drop below ----
+
+UPDATE log_entries SET user_id = logs.user_id
+FROM logs WHERE log_entries.log_id = logs.id AND log_entries.user_id IS NULL;
+
+ALTER TABLE log_entries DROP COLUMN deleted_username;
+ALTER TABLE log_entries ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,17 @@
+-- The streaks of a log's goal over the periods before through, so the goal's
+-- status only needs the entries from through on. A row is deleted whenever
+-- entries before through change, and ignored if goal no longer matches the
+-- log's goal.
+CREATE TABLE goal_streaks (
+    log_id uuid PRIMARY KEY REFERENCES logs(id) ON DELETE CASCADE,
+    goal jsonb NOT NULL,
+    through timestamptz NOT NULL,
+    longest integer NOT NULL,
+    run integer NOT NULL
+);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON goal_streaks TO {{.app_user}};
+
+---- create above / drop below ----
+
+DROP TABLE goal_streaks;
@@ -3,6 +3,10 @@
 
 -- Clean the test database so tern can re-run migrations from scratch.
 \c logger4life_test
+DROP TABLE IF EXISTS goal_streaks CASCADE;
+DROP TABLE IF EXISTS reminder_deliveries CASCADE;
+DROP TABLE IF EXISTS reminder_rules CASCADE;
+DROP TABLE IF EXISTS idempotency_keys CASCADE;
 DROP TABLE IF EXISTS webauthn_challenges CASCADE;
 DROP TABLE IF EXISTS passkeys CASCADE;
 DROP TABLE IF EXISTS log_shares CASCADE;
@@ -291,19 +291,62 @@ test('entries with old fields still display after editing log fields', async ({
 	await page.click('button:has-text("Log It")');
 	await expect(page.locator('[data-testid="log-entry"]').first()).toContainText('25');
 
-	// Edit fields: change "count" to "reps"
+	// Edit fields: rename "count" to "reps"
 	await page.click('[data-testid="edit-log"]');
-	await page.locator('form button:has-text("×")').first().click();
-	await page.click('button:has-text("Add Field")');
 	await page.fill('input[placeholder="Field name"]', 'reps');
 	await page.click('[data-testid="save-log"]');
 
-	// Old entry still displays its "count: 25" value
+	// Old entry displays its value under the new name
 	const entry = page.locator('[data-testid="log-entry"]').first();
-	await expect(entry).toContainText('count');
+	await expect(entry).toContainText('reps');
 	await expect(entry).toContainText('25');
 });
 
+test('deleting a field with values asks for confirmation', async ({ page }) => {
+	await registerAndLogin(page);
+
+	await page.fill('input[name="log-name"]', 'Exercise');
+	await page.click('button:has-text("Add Field")');
+	await page.fill('input[placeholder="Field name"]', 'count');
+	await page.click('button:has-text("Create Log")');
+	await page.click('a:has-text("Exercise")');
+
+	await page.fill('input[name="field-count"]', '25');
+	await page.click('button:has-text("Log It")');
+	await expect(page.locator('[data-testid="log-entry"]').first()).toContainText('25');
+
+	// Declining the confirmation keeps the field and its values
+	let message = '';
+	page.once('dialog', dialog => {
+		message = dialog.message();
+		dialog.dismiss();
+	});
+	await page.click('[data-testid="edit-log"]');
+	await page.locator('form button:has-text("×")').first().click();
+	await page.click('[data-testid="save-log"]');
+	await expect(page.locator('[data-testid="save-log"]')).toBeEnabled();
+	expect(message).toContain('Delete "count" and its values in 1 entries');
+
+	page.once('dialog', dialog => dialog.accept());
+	await page.click('[data-testid="save-log"]');
+	await expect(page.locator('input[name="field-count"]')).not.toBeVisible();
+	await expect(page.locator('[data-testid="log-entry"]').first()).not.toContainText('count');
+});
+
+test('edit log rejects fields without a name', async ({ page }) => {
+	await registerAndLogin(page);
+
+	await page.fill('input[name="log-name"]', 'Exercise');
+	await page.click('button:has-text("Create Log")');
+	await page.click('a:has-text("Exercise")');
+
+	await page.click('[data-testid="edit-log"]');
+	await page.click('button:has-text("Add Field")');
+	await page.click('[data-testid="save-log"]');
+
+	await expect(page.getByText('Every field needs a name')).toBeVisible();
+});
+
 test('delete a log', async ({ page }) => {
 	await registerAndLogin(page);
 